@@ -0,0 +1,3 @@
+-- Positions are kept out of match_data since they're only needed when
+-- rendering heatmaps and can get quite large
+ALTER TABLE matches ADD COLUMN positions JSON NOT NULL DEFAULT '[]';
@@ -0,0 +1,23 @@
+CREATE TABLE parse_jobs (
+  id TEXT NOT NULL,
+  demo_id TEXT NOT NULL,
+  -- full path to the demo file
+  path TEXT NOT NULL,
+  -- queued, running, done or failed
+  status TEXT NOT NULL,
+  -- the error from the most recent attempt, if any
+  error TEXT NOT NULL DEFAULT '',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  -- the user that uploaded the demo. null if the demo was picked up
+  -- from the demos folder
+  username TEXT,
+  -- unix millis
+  created_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL,
+
+  FOREIGN KEY (username) REFERENCES users (username) ON DELETE SET NULL ON UPDATE CASCADE,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX parse_jobs_status_idx ON parse_jobs (status, created_at);
+CREATE INDEX parse_jobs_path_idx ON parse_jobs (path, created_at);
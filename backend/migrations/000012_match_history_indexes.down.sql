@@ -0,0 +1,9 @@
+DROP INDEX matches_score_idx;
+DROP INDEX matches_team_b_title_idx;
+DROP INDEX matches_team_a_title_idx;
+DROP INDEX matches_demo_type_idx;
+DROP INDEX matches_map_idx;
+DROP INDEX matches_date_idx;
+DROP INDEX matches_player_names_idx;
+
+ALTER TABLE matches ALTER COLUMN player_names TYPE JSON USING player_names::JSON;
@@ -0,0 +1,15 @@
+-- player_names needs to be JSONB so that the "which matches was this player
+-- in" lookup can use a GIN index instead of scanning every row
+ALTER TABLE matches ALTER COLUMN player_names TYPE JSONB USING player_names::JSONB;
+
+CREATE INDEX matches_player_names_idx ON matches USING GIN (player_names);
+CREATE INDEX matches_date_idx ON matches (date);
+CREATE INDEX matches_map_idx ON matches (map);
+CREATE INDEX matches_demo_type_idx ON matches (demo_type);
+CREATE INDEX matches_team_a_title_idx ON matches (LOWER(team_a_title));
+CREATE INDEX matches_team_b_title_idx ON matches (LOWER(team_b_title));
+-- score filters don't care which team won
+CREATE INDEX matches_score_idx ON matches (
+  GREATEST(team_a_score, team_b_score),
+  LEAST(team_a_score, team_b_score)
+);
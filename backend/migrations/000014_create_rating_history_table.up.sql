@@ -0,0 +1,18 @@
+-- Every player's rating before and after each match. The whole table is
+-- recomputed in date order whenever a match is added, deleted or restored
+CREATE TABLE rating_history (
+  match_id TEXT NOT NULL,
+  steam_id TEXT NOT NULL,
+  -- the match date in unix millis
+  date BIGINT NOT NULL,
+  -- position of the match in the rating order starting at 1. used to find
+  -- the latest rating for each player
+  seq INTEGER NOT NULL,
+  rating_before DOUBLE PRECISION NOT NULL,
+  rating_after DOUBLE PRECISION NOT NULL,
+
+  FOREIGN KEY (match_id) REFERENCES matches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  PRIMARY KEY (match_id, steam_id)
+);
+
+CREATE INDEX rating_history_steam_id_idx ON rating_history (steam_id, seq);
@@ -0,0 +1,12 @@
+ALTER TABLE match_player_stats
+  DROP COLUMN shots_fired,
+  DROP COLUMN shots_hit,
+  DROP COLUMN accuracy,
+  DROP COLUMN first_shots_fired,
+  DROP COLUMN first_shots_hit,
+  DROP COLUMN first_shot_accuracy,
+  DROP COLUMN head_hits,
+  DROP COLUMN chest_hits,
+  DROP COLUMN stomach_hits,
+  DROP COLUMN arm_hits,
+  DROP COLUMN leg_hits;
@@ -0,0 +1,13 @@
+-- Matches parsed before these were added get zeroes until they're reparsed
+ALTER TABLE match_player_stats
+  ADD COLUMN shots_fired INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN shots_hit INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN accuracy DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN first_shots_fired INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN first_shots_hit INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN first_shot_accuracy DOUBLE PRECISION NOT NULL DEFAULT 0,
+  ADD COLUMN head_hits INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN chest_hits INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN stomach_hits INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN arm_hits INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN leg_hits INTEGER NOT NULL DEFAULT 0;
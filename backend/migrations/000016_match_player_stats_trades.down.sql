@@ -0,0 +1,3 @@
+ALTER TABLE match_player_stats
+  DROP COLUMN failed_trades,
+  DROP COLUMN time_to_trade;
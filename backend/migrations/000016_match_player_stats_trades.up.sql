@@ -0,0 +1,4 @@
+-- Matches parsed before these were added get zeroes until they're reparsed
+ALTER TABLE match_player_stats
+  ADD COLUMN failed_trades INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN time_to_trade DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE utility (
+  match_id TEXT NOT NULL,
+  -- starting at 1
+  round INTEGER NOT NULL,
+  grenades JSON NOT NULL,
+
+  -- grenades follow their match around when it's renamed or deleted
+  FOREIGN KEY (match_id) REFERENCES matches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  PRIMARY KEY (match_id, round)
+);
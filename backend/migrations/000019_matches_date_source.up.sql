@@ -0,0 +1,3 @@
+-- Matches parsed before this was added have no source until they're
+-- reparsed or the dates are recomputed with the recompute-dates command
+ALTER TABLE matches ADD COLUMN date_source TEXT NOT NULL DEFAULT '';
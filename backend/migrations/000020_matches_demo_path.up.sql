@@ -0,0 +1,4 @@
+-- Matches parsed before this was added were all parsed from uncompressed
+-- demos named after the match
+ALTER TABLE matches ADD COLUMN demo_path TEXT NOT NULL DEFAULT '';
+UPDATE matches SET demo_path = id || '.dem';
@@ -0,0 +1 @@
+DROP TABLE match_player_weapons;
@@ -0,0 +1,65 @@
+-- One row per player per weapon per match with the same totals that are in
+-- the weapons part of the match_data stats. Lets player profiles add up
+-- weapon stats without decoding every match
+CREATE TABLE match_player_weapons (
+  match_id TEXT NOT NULL,
+  steam_id TEXT NOT NULL,
+  weapon TEXT NOT NULL,
+
+  kills INTEGER NOT NULL DEFAULT 0,
+  headshots INTEGER NOT NULL DEFAULT 0,
+  damage INTEGER NOT NULL DEFAULT 0,
+  shots INTEGER NOT NULL DEFAULT 0,
+  hits INTEGER NOT NULL DEFAULT 0,
+  first_shots INTEGER NOT NULL DEFAULT 0,
+  first_shot_hits INTEGER NOT NULL DEFAULT 0,
+  head_hits INTEGER NOT NULL DEFAULT 0,
+  chest_hits INTEGER NOT NULL DEFAULT 0,
+  stomach_hits INTEGER NOT NULL DEFAULT 0,
+  arm_hits INTEGER NOT NULL DEFAULT 0,
+  leg_hits INTEGER NOT NULL DEFAULT 0,
+
+  FOREIGN KEY (match_id) REFERENCES matches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  PRIMARY KEY (match_id, steam_id, weapon)
+);
+
+CREATE INDEX match_player_weapons_steam_id_idx ON match_player_weapons (steam_id);
+
+-- Backfill from the matches that have already been parsed. Deleted matches are
+-- included too since the queries filter them out anyway
+INSERT INTO match_player_weapons (
+  match_id,
+  steam_id,
+  weapon,
+  kills,
+  headshots,
+  damage,
+  shots,
+  hits,
+  first_shots,
+  first_shot_hits,
+  head_hits,
+  chest_hits,
+  stomach_hits,
+  arm_hits,
+  leg_hits
+)
+SELECT
+  matches.id,
+  players.key,
+  weapons.key,
+  COALESCE((weapons.value->>'kills')::INTEGER, 0),
+  COALESCE((weapons.value->>'headshots')::INTEGER, 0),
+  COALESCE((weapons.value->>'damage')::INTEGER, 0),
+  COALESCE((weapons.value->>'shots')::INTEGER, 0),
+  COALESCE((weapons.value->>'hits')::INTEGER, 0),
+  COALESCE((weapons.value->>'firstShots')::INTEGER, 0),
+  COALESCE((weapons.value->>'firstShotHits')::INTEGER, 0),
+  COALESCE((weapons.value->>'headHits')::INTEGER, 0),
+  COALESCE((weapons.value->>'chestHits')::INTEGER, 0),
+  COALESCE((weapons.value->>'stomachHits')::INTEGER, 0),
+  COALESCE((weapons.value->>'armHits')::INTEGER, 0),
+  COALESCE((weapons.value->>'legHits')::INTEGER, 0)
+FROM matches,
+  json_each(COALESCE(matches.match_data->'stats'->'weapons', '{}'::JSON)) AS players,
+  json_each(players.value) AS weapons;
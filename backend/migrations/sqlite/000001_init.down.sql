@@ -0,0 +1,5 @@
+DROP TABLE auditlog;
+DROP TABLE invalid_tokens;
+DROP TABLE users;
+DROP TABLE usermeta;
+DROP TABLE matches;
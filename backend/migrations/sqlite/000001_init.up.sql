@@ -0,0 +1,70 @@
+-- SQLite equivalent of the Postgres migrations 000001 to 000008. The match
+-- data is stored as JSON text in the same way as it is in Postgres
+CREATE TABLE matches (
+  id TEXT NOT NULL,
+  version INTEGER NOT NULL DEFAULT 1,
+  deleted BOOLEAN NOT NULL DEFAULT FALSE,
+  map TEXT NOT NULL,
+  date BIGINT NOT NULL,
+  demo_type TEXT NOT NULL,
+  player_names TEXT NOT NULL,
+  team_a_score INTEGER NOT NULL,
+  team_b_score INTEGER NOT NULL,
+  team_a_title TEXT NOT NULL,
+  team_b_title TEXT NOT NULL,
+  match_data TEXT NOT NULL,
+
+  PRIMARY KEY (id),
+  -- after Jan 1 2012
+  CONSTRAINT sane_date CHECK (date >= 1325376000000),
+  CONSTRAINT sane_team_a_score CHECK (team_a_score >= 0),
+  CONSTRAINT sane_team_b_score CHECK (team_b_score >= 0)
+);
+
+CREATE TABLE usermeta (
+  mapid TEXT NOT NULL,
+  demo_link TEXT,
+  date_override BIGINT,
+
+  -- when a match is deleted its user metadata should be removed as well
+  FOREIGN KEY (mapid) REFERENCES matches (id) ON DELETE CASCADE,
+  PRIMARY KEY (mapid)
+);
+
+CREATE TABLE users (
+  username TEXT NOT NULL,
+  display_name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  password_argon TEXT NOT NULL,
+  -- JSON array of strings since SQLite doesn't have array types
+  roles TEXT NOT NULL DEFAULT '[]',
+
+  steam_id TEXT,
+
+  PRIMARY KEY (username)
+);
+
+CREATE TABLE invalid_tokens (
+  expiry BIGINT NOT NULL,
+  token TEXT NOT NULL,
+
+  PRIMARY KEY (token)
+);
+
+CREATE TABLE auditlog (
+  -- unix millis
+  timestamp BIGINT NOT NULL,
+  -- whether the action was performed by the backend or initiated by a user.
+  -- this is to differentiate between system-initiated events and events
+  -- that were initiated by a deleted user
+  system BOOLEAN NOT NULL,
+  username TEXT,
+
+  action TEXT NOT NULL,
+  description TEXT NOT NULL,
+
+  -- if a user's username is updated it should cascade to this table. if the user is deleted
+  -- we still want to keep the audit log entry so we will set the user to null
+  FOREIGN KEY (username) REFERENCES users (username) ON DELETE SET NULL ON UPDATE CASCADE,
+  PRIMARY KEY (timestamp)
+);
@@ -0,0 +1 @@
+DROP TABLE parse_jobs;
@@ -0,0 +1,6 @@
+DROP INDEX matches_score_idx;
+DROP INDEX matches_team_b_title_idx;
+DROP INDEX matches_team_a_title_idx;
+DROP INDEX matches_demo_type_idx;
+DROP INDEX matches_map_idx;
+DROP INDEX matches_date_idx;
@@ -0,0 +1,10 @@
+CREATE INDEX matches_date_idx ON matches (date);
+CREATE INDEX matches_map_idx ON matches (map);
+CREATE INDEX matches_demo_type_idx ON matches (demo_type);
+CREATE INDEX matches_team_a_title_idx ON matches (LOWER(team_a_title));
+CREATE INDEX matches_team_b_title_idx ON matches (LOWER(team_b_title));
+-- score filters don't care which team won
+CREATE INDEX matches_score_idx ON matches (
+  MAX(team_a_score, team_b_score),
+  MIN(team_a_score, team_b_score)
+);
@@ -0,0 +1,167 @@
+-- One row per player per match with the same stats that are in the match_data
+-- JSON. Lets us do cross-match queries (leaderboards, career stats etc) without
+-- decoding every match. The stat columns are the db tags on the Stats struct
+CREATE TABLE match_player_stats (
+  match_id TEXT NOT NULL,
+  steam_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  -- same values as the teams map in match_data: CT for team A and T for team B
+  team TEXT NOT NULL,
+  -- the side the player's team started the match on
+  start_side TEXT NOT NULL,
+
+  adr REAL NOT NULL DEFAULT 0,
+  assists INTEGER NOT NULL DEFAULT 0,
+  deaths INTEGER NOT NULL DEFAULT 0,
+  ef_per_flash REAL NOT NULL DEFAULT 0,
+  enemies_flashed INTEGER NOT NULL DEFAULT 0,
+  flash_assists INTEGER NOT NULL DEFAULT 0,
+  flashes_thrown INTEGER NOT NULL DEFAULT 0,
+  hes_thrown INTEGER NOT NULL DEFAULT 0,
+  headshot_pct REAL NOT NULL DEFAULT 0,
+  hltv REAL NOT NULL DEFAULT 0,
+  impact REAL NOT NULL DEFAULT 0,
+  kast REAL NOT NULL DEFAULT 0,
+  kd REAL NOT NULL DEFAULT 0,
+  kdiff INTEGER NOT NULL DEFAULT 0,
+  kills INTEGER NOT NULL DEFAULT 0,
+  kpr REAL NOT NULL DEFAULT 0,
+  mollies_thrown INTEGER NOT NULL DEFAULT 0,
+  opening_attempts INTEGER NOT NULL DEFAULT 0,
+  opening_attempts_pct REAL NOT NULL DEFAULT 0,
+  opening_deaths INTEGER NOT NULL DEFAULT 0,
+  opening_kills INTEGER NOT NULL DEFAULT 0,
+  opening_success REAL NOT NULL DEFAULT 0,
+  rws REAL NOT NULL DEFAULT 0,
+  smokes_thrown INTEGER NOT NULL DEFAULT 0,
+  teammates_flashed INTEGER NOT NULL DEFAULT 0,
+  deaths_traded INTEGER NOT NULL DEFAULT 0,
+  trade_kills INTEGER NOT NULL DEFAULT 0,
+  util_damage INTEGER NOT NULL DEFAULT 0,
+  clutch_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_wins INTEGER NOT NULL DEFAULT 0,
+  clutch_1v1_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_1v1_wins INTEGER NOT NULL DEFAULT 0,
+  clutch_1v2_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_1v2_wins INTEGER NOT NULL DEFAULT 0,
+  clutch_1v3_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_1v3_wins INTEGER NOT NULL DEFAULT 0,
+  clutch_1v4_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_1v4_wins INTEGER NOT NULL DEFAULT 0,
+  clutch_1v5_attempts INTEGER NOT NULL DEFAULT 0,
+  clutch_1v5_wins INTEGER NOT NULL DEFAULT 0,
+  k2 INTEGER NOT NULL DEFAULT 0,
+  k3 INTEGER NOT NULL DEFAULT 0,
+  k4 INTEGER NOT NULL DEFAULT 0,
+  k5 INTEGER NOT NULL DEFAULT 0,
+
+  FOREIGN KEY (match_id) REFERENCES matches (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  PRIMARY KEY (match_id, steam_id)
+);
+
+CREATE INDEX match_player_stats_steam_id_idx ON match_player_stats (steam_id);
+
+-- Backfill from the matches that have already been parsed. Deleted matches are
+-- included too since the queries filter them out anyway
+INSERT INTO match_player_stats (
+  match_id,
+  steam_id,
+  name,
+  team,
+  start_side,
+  adr,
+  assists,
+  deaths,
+  ef_per_flash,
+  enemies_flashed,
+  flash_assists,
+  flashes_thrown,
+  hes_thrown,
+  headshot_pct,
+  hltv,
+  impact,
+  kast,
+  kd,
+  kdiff,
+  kills,
+  kpr,
+  mollies_thrown,
+  opening_attempts,
+  opening_attempts_pct,
+  opening_deaths,
+  opening_kills,
+  opening_success,
+  rws,
+  smokes_thrown,
+  teammates_flashed,
+  deaths_traded,
+  trade_kills,
+  util_damage,
+  clutch_attempts,
+  clutch_wins,
+  clutch_1v1_attempts,
+  clutch_1v1_wins,
+  clutch_1v2_attempts,
+  clutch_1v2_wins,
+  clutch_1v3_attempts,
+  clutch_1v3_wins,
+  clutch_1v4_attempts,
+  clutch_1v4_wins,
+  clutch_1v5_attempts,
+  clutch_1v5_wins,
+  k2,
+  k3,
+  k4,
+  k5
+)
+SELECT
+  matches.id,
+  teams.key,
+  COALESCE(json_extract(matches.player_names, '$."' || teams.key || '"'), ''),
+  teams.value,
+  COALESCE(json_extract(matches.match_data, '$.startTeams."' || teams.key || '"'), ''),
+  COALESCE(json_extract(matches.match_data, '$.stats."adr"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."assists"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."deaths"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."efPerFlash"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."enemiesFlashed"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."flashAssists"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."flashesThrown"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."HEsThrown"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."headshotPct"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."hltv"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."impact"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."kast"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."kd"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."kdiff"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."kills"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."kpr"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."molliesThrown"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."openingAttempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."openingAttemptsPct"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."openingDeaths"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."openingKills"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."openingSuccess"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."rws"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."smokesThrown"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."teammatesFlashed"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."deathsTraded"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."tradeKills"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."utilDamage"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutchAttempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutchWins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v1Attempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v1Wins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v2Attempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v2Wins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v3Attempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v3Wins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v4Attempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v4Wins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v5Attempts"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."clutch1v5Wins"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."2k"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."3k"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."4k"."' || teams.key || '"'), 0),
+  COALESCE(json_extract(matches.match_data, '$.stats."5k"."' || teams.key || '"'), 0)
+FROM matches, json_each(matches.match_data, '$.teams') AS teams;
@@ -0,0 +1,11 @@
+ALTER TABLE match_player_stats DROP COLUMN shots_fired;
+ALTER TABLE match_player_stats DROP COLUMN shots_hit;
+ALTER TABLE match_player_stats DROP COLUMN accuracy;
+ALTER TABLE match_player_stats DROP COLUMN first_shots_fired;
+ALTER TABLE match_player_stats DROP COLUMN first_shots_hit;
+ALTER TABLE match_player_stats DROP COLUMN first_shot_accuracy;
+ALTER TABLE match_player_stats DROP COLUMN head_hits;
+ALTER TABLE match_player_stats DROP COLUMN chest_hits;
+ALTER TABLE match_player_stats DROP COLUMN stomach_hits;
+ALTER TABLE match_player_stats DROP COLUMN arm_hits;
+ALTER TABLE match_player_stats DROP COLUMN leg_hits;
@@ -0,0 +1,12 @@
+-- Matches parsed before these were added get zeroes until they're reparsed
+ALTER TABLE match_player_stats ADD COLUMN shots_fired INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN shots_hit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN accuracy REAL NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN first_shots_fired INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN first_shots_hit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN first_shot_accuracy REAL NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN head_hits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN chest_hits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN stomach_hits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN arm_hits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN leg_hits INTEGER NOT NULL DEFAULT 0;
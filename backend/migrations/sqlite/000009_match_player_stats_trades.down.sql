@@ -0,0 +1,2 @@
+ALTER TABLE match_player_stats DROP COLUMN failed_trades;
+ALTER TABLE match_player_stats DROP COLUMN time_to_trade;
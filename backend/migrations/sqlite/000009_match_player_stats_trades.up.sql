@@ -0,0 +1,3 @@
+-- Matches parsed before these were added get zeroes until they're reparsed
+ALTER TABLE match_player_stats ADD COLUMN failed_trades INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE match_player_stats ADD COLUMN time_to_trade REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Matches parsed before this was added get 0 until they're reparsed
+ALTER TABLE matches ADD COLUMN demo_type_confidence REAL NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE matches DROP COLUMN demo_root;
@@ -0,0 +1 @@
+ALTER TABLE matches ADD COLUMN demo_root INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE parse_jobs DROP COLUMN retry_at;
@@ -0,0 +1,2 @@
+-- unix millis. Jobs that failed aren't picked up again until then
+ALTER TABLE parse_jobs ADD COLUMN retry_at BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	MaxBalancePlayers = 16
+	NumBalanceSplits  = 5
+
+	// How many rating points a player gains or loses for each 1.0 of
+	// HLTV rating they are above or below average on the chosen map
+	MapRatingScale = 200.0
+	// The number of matches on a map a player needs before their stats
+	// on that map are fully trusted. Players with fewer matches only get
+	// part of the adjustment
+	MapConfidenceMatches = 5
+)
+
+type BalancePlayer struct {
+	SteamId uint64  `json:"steamId,string"`
+	Name    string  `json:"name"`
+	Rating  float64 `json:"rating"`
+	// The player's rating adjusted for how they play on the chosen map.
+	// Same as the rating if no map was given
+	Strength   float64 `json:"strength"`
+	MapHltv    float64 `json:"mapHltv"`
+	MapMatches int     `json:"mapMatches"`
+}
+
+type TeamSplit struct {
+	TeamA []BalancePlayer `json:"teamA"`
+	TeamB []BalancePlayer `json:"teamB"`
+	// Average strength of each team
+	TeamARating         float64 `json:"teamARating"`
+	TeamBRating         float64 `json:"teamBRating"`
+	TeamAWinProbability float64 `json:"teamAWinProbability"`
+}
+
+func averageStrength(players []BalancePlayer) float64 {
+	total := 0.0
+	for _, player := range players {
+		total += player.Strength
+	}
+	return total / float64(len(players))
+}
+
+func (p *BalancePlayer) applyMapStats(hltv float64, matches int) {
+	confidence := float64(min(matches, MapConfidenceMatches)) / MapConfidenceMatches
+	p.MapHltv = hltv
+	p.MapMatches = matches
+	p.Strength = p.Rating + (hltv-1)*MapRatingScale*confidence
+}
+
+// Look up the ratings of the given players and, if a map is given, adjust
+// them based on each player's HLTV rating on that map. Players that
+// haven't played yet start at the initial rating
+func getBalancePlayers(steamIds []uint64, mapName, demoType string, c Context) ([]BalancePlayer, error) {
+	ratings, err := c.db.GetRatings(steamIds)
+	if err != nil {
+		return nil, err
+	}
+
+	ratingsMap := make(map[uint64]PlayerRating, len(ratings))
+	for _, rating := range ratings {
+		ratingsMap[rating.SteamId] = rating
+	}
+
+	players := make([]BalancePlayer, 0, len(steamIds))
+	for _, steamId := range steamIds {
+		player := BalancePlayer{SteamId: steamId, Rating: InitialRating}
+		if rating, ok := ratingsMap[steamId]; ok {
+			player.Name = rating.Name
+			player.Rating = rating.Rating
+		}
+		player.Strength = player.Rating
+		players = append(players, player)
+	}
+
+	if mapName == "" {
+		return players, nil
+	}
+
+	mapStats, err := c.db.GetLeaderboard(LeaderboardFilter{
+		Metric:     "hltv",
+		MinMatches: 1,
+		Limit:      len(steamIds),
+		Map:        mapName,
+		DemoType:   demoType,
+		SteamIds:   steamIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mapStatsMap := make(map[uint64]LeaderboardEntry, len(mapStats))
+	for _, entry := range mapStats {
+		mapStatsMap[entry.SteamId] = entry
+	}
+
+	for i := range players {
+		if entry, ok := mapStatsMap[players[i].SteamId]; ok {
+			if players[i].Name == "" {
+				players[i].Name = entry.Name
+			}
+			players[i].applyMapStats(entry.Value, entry.Matches)
+		}
+	}
+
+	return players, nil
+}
+
+// Try every way of splitting the players into two even teams and return
+// the fairest ones first. The first player is always put on team A so
+// that we don't try each split twice with the teams swapped
+func balanceTeams(players []BalancePlayer, numSplits int) []TeamSplit {
+	teamSize := len(players) / 2
+	splits := make([]TeamSplit, 0)
+
+	var choose func(start int, teamA []int)
+	choose = func(start int, teamA []int) {
+		if len(teamA) == teamSize {
+			inA := make(map[int]bool, teamSize)
+			for _, i := range teamA {
+				inA[i] = true
+			}
+
+			split := TeamSplit{
+				TeamA: make([]BalancePlayer, 0, teamSize),
+				TeamB: make([]BalancePlayer, 0, teamSize),
+			}
+			for i, player := range players {
+				if inA[i] {
+					split.TeamA = append(split.TeamA, player)
+				} else {
+					split.TeamB = append(split.TeamB, player)
+				}
+			}
+
+			split.TeamARating = averageStrength(split.TeamA)
+			split.TeamBRating = averageStrength(split.TeamB)
+			split.TeamAWinProbability = expectedScore(split.TeamARating, split.TeamBRating)
+			splits = append(splits, split)
+			return
+		}
+
+		for i := start; i < len(players); i++ {
+			choose(i+1, append(teamA, i))
+		}
+	}
+
+	choose(1, []int{0})
+
+	sort.SliceStable(splits, func(i, j int) bool {
+		return math.Abs(splits[i].TeamAWinProbability-0.5) <
+			math.Abs(splits[j].TeamAWinProbability-0.5)
+	})
+
+	if len(splits) > numSplits {
+		splits = splits[:numSplits]
+	}
+
+	for i := range splits {
+		for j := range splits[i].TeamA {
+			splits[i].TeamA[j].Strength = round2(splits[i].TeamA[j].Strength)
+		}
+		for j := range splits[i].TeamB {
+			splits[i].TeamB[j].Strength = round2(splits[i].TeamB[j].Strength)
+		}
+		splits[i].TeamARating = round2(splits[i].TeamARating)
+		splits[i].TeamBRating = round2(splits[i].TeamBRating)
+		splits[i].TeamAWinProbability = round2(splits[i].TeamAWinProbability)
+	}
+
+	return splits
+}
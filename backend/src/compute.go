@@ -200,6 +200,66 @@ func computeMultikills(kills []PlayerIntMap) (PlayerIntMap, PlayerIntMap, Player
 	return k2, k3, k4, k5
 }
 
+// returns attempts, wins, attempts by number of opponents, wins by number
+// of opponents. the arrays are indexed by opponents - 1 (1v1 is index 0)
+func computeClutches(clutches []*Clutch) (
+	PlayerIntMap,
+	PlayerIntMap,
+	[5]PlayerIntMap,
+	[5]PlayerIntMap,
+) {
+	attempts := make(PlayerIntMap)
+	wins := make(PlayerIntMap)
+	var attemptsByX, winsByX [5]PlayerIntMap
+	for i := range attemptsByX {
+		attemptsByX[i] = make(PlayerIntMap)
+		winsByX[i] = make(PlayerIntMap)
+	}
+
+	for _, clutch := range clutches {
+		// 1v6+ can happen in custom games but we don't care about those
+		if clutch == nil || clutch.Opponents < 1 || clutch.Opponents > 5 {
+			continue
+		}
+
+		attempts[clutch.Player] += 1
+		attemptsByX[clutch.Opponents-1][clutch.Player] += 1
+		if clutch.Won {
+			wins[clutch.Player] += 1
+			winsByX[clutch.Opponents-1][clutch.Player] += 1
+		}
+	}
+
+	return attempts, wins, attemptsByX, winsByX
+}
+
+// returns failed trades, average time to trade in seconds
+func computeTrades(trades [][]Trade) (PlayerIntMap, PlayerF64Map) {
+	failed := make(PlayerIntMap)
+	timeToTrade := make(PlayerF64Map)
+	numTrades := make(PlayerIntMap)
+
+	for _, roundTrades := range trades {
+		for _, trade := range roundTrades {
+			if trade.Trader == 0 {
+				for _, player := range trade.Nearby {
+					failed[player] += 1
+				}
+				continue
+			}
+
+			numTrades[trade.Trader] += 1
+			timeToTrade[trade.Trader] += float64(trade.TradeTime-trade.DeathTime) / 1000
+		}
+	}
+
+	for player, total := range timeToTrade {
+		timeToTrade[player] = round2(total / float64(numTrades[player]))
+	}
+
+	return failed, timeToTrade
+}
+
 func computeEFPerFlash(flashesThrown PlayerIntMap, enemiesFlashed PlayerIntMap) PlayerF64Map {
 	ret := make(PlayerF64Map)
 	for player, f := range flashesThrown {
@@ -208,9 +268,9 @@ func computeEFPerFlash(flashesThrown PlayerIntMap, enemiesFlashed PlayerIntMap)
 	return ret
 }
 
-func computeStartSides(teams map[uint64]string, rounds []Round, halfLength int) map[uint64]string {
-	_, teamAStartSide := getScore(rounds, "CT", 1, halfLength)
-	_, teamBStartSide := getScore(rounds, "T", 1, halfLength)
+func computeStartSides(teams map[uint64]string, rounds []Round, halfLength, overtimeLength int) map[uint64]string {
+	_, teamAStartSide := getScore(rounds, "CT", 1, halfLength, overtimeLength)
+	_, teamBStartSide := getScore(rounds, "T", 1, halfLength, overtimeLength)
 	ret := make(map[uint64]string)
 	for player, team := range teams {
 		if team == "CT" {
@@ -223,6 +283,51 @@ func computeStartSides(teams map[uint64]string, rounds []Round, halfLength int)
 	return ret
 }
 
+// Splits the rounds up into the two regulation halves followed by the
+// halves of each overtime period. Halves that were never played are left
+// out and the last half is cut short if the match ended partway through it
+func computeHalves(rounds []Round, halfLength, overtimeLength int) []Half {
+	var ret []Half
+	start := 0
+	for start < len(rounds) {
+		length := halfLength
+		overtime := 0
+		if start >= halfLength*2 {
+			length = overtimeLength / 2
+			overtime = (start-halfLength*2)/max(overtimeLength, 1) + 1
+		}
+
+		if length <= 0 {
+			break
+		}
+
+		end := min(start+length, len(rounds))
+		_, teamASide := getScore(rounds, "CT", start+1, halfLength, overtimeLength)
+		_, teamBSide := getScore(rounds, "T", start+1, halfLength, overtimeLength)
+
+		half := Half{
+			Overtime:   overtime,
+			StartRound: start,
+			EndRound:   end,
+			TeamASide:  teamASide,
+			TeamBSide:  teamBSide,
+		}
+
+		for _, round := range rounds[start:end] {
+			if round.Winner == teamASide {
+				half.TeamAScore += 1
+			} else if round.Winner == teamBSide {
+				half.TeamBScore += 1
+			}
+		}
+
+		ret = append(ret, half)
+		start = end
+	}
+
+	return ret
+}
+
 func computeOpenings(openingKills []OpeningKill) (
 	PlayerIntMap,
 	PlayerIntMap,
@@ -255,12 +360,72 @@ func computeOpenings(openingKills []OpeningKill) (
 	return oKills, oDeaths, oAttempts, oAttemptsPct, oSuccess
 }
 
-func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength int) []RoundOverview {
+const (
+	BuyTypePistol = "pistol"
+	BuyTypeEco    = "eco"
+	BuyTypeForce  = "force"
+	BuyTypeHalf   = "half"
+	BuyTypeFull   = "full"
+
+	// Average equipment value per player. Anything under the eco threshold
+	// is a save, anything over the full threshold is rifles + utility
+	ecoEquipmentThreshold  = 1500
+	fullEquipmentThreshold = 4000
+
+	// If the team has less than this much money left per player on average
+	// after buying, they spent everything they had and it's a force buy.
+	// Otherwise they were saving some of it for the next round
+	forceLeftoverThreshold = 1000
+)
+
+func classifyBuy(economy TeamEconomy, isPistol bool) string {
+	if isPistol {
+		return BuyTypePistol
+	}
+
+	if economy.NumPlayers == 0 {
+		return ""
+	}
+
+	avgEquipment := economy.EquipmentValue / economy.NumPlayers
+	avgLeftover := (economy.StartMoney - economy.MoneySpent) / economy.NumPlayers
+
+	switch {
+	case avgEquipment < ecoEquipmentThreshold:
+		return BuyTypeEco
+	case avgEquipment >= fullEquipmentThreshold:
+		return BuyTypeFull
+	case avgLeftover < forceLeftoverThreshold:
+		return BuyTypeForce
+	default:
+		return BuyTypeHalf
+	}
+}
+
+func computeBuyTypes(rounds []Round, halfLength int) {
+	for i := range rounds {
+		isPistol := i == 0 || i == halfLength
+		rounds[i].CTEconomy.BuyType = classifyBuy(rounds[i].CTEconomy, isPistol)
+		rounds[i].TEconomy.BuyType = classifyBuy(rounds[i].TEconomy, isPistol)
+	}
+}
+
+func computeRoundByRound(
+	rounds []Round,
+	killFeed KillFeed,
+	clutches []*Clutch,
+	trades [][]Trade,
+	startMoney []PlayerIntMap,
+	equipmentValue []PlayerIntMap,
+	moneySpent []PlayerIntMap,
+	halfLength int,
+	overtimeLength int,
+) []RoundOverview {
 	var ret []RoundOverview
 	for i, k := range killFeed {
 		roundInfo := rounds[i]
-		teamAScore, teamASide := getScore(rounds, "CT", i+1, halfLength)
-		teamBScore, teamBSide := getScore(rounds, "T", i+1, halfLength)
+		teamAScore, teamASide := getScore(rounds, "CT", i+1, halfLength, overtimeLength)
+		teamBScore, teamBSide := getScore(rounds, "T", i+1, halfLength, overtimeLength)
 		var events []RoundEvent
 
 		for killer, k2 := range k {
@@ -276,6 +441,30 @@ func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength int) []Ro
 			}
 		}
 
+		for _, trade := range trades[i] {
+			if trade.Trader != 0 {
+				events = append(events, RoundEvent{
+					Kind:        "trade",
+					Time:        trade.TradeTime,
+					Killer:      trade.Trader,
+					Victim:      trade.Killer,
+					Traded:      trade.Traded,
+					TimeToTrade: trade.TradeTime - trade.DeathTime,
+				})
+				continue
+			}
+
+			for _, player := range trade.Nearby {
+				events = append(events, RoundEvent{
+					Kind:   "failed_trade",
+					Time:   trade.DeathTime,
+					Killer: trade.Killer,
+					Traded: trade.Traded,
+					Player: player,
+				})
+			}
+		}
+
 		if roundInfo.Planter != 0 {
 			events = append(events, RoundEvent{
 				Kind:    "plant",
@@ -303,14 +492,45 @@ func computeRoundByRound(rounds []Round, killFeed KillFeed, halfLength int) []Ro
 			return events[i].Time < events[j].Time
 		})
 
+		economy := make(map[uint64]PlayerEconomy)
+		for player, money := range startMoney[i] {
+			economy[player] = PlayerEconomy{
+				StartMoney:     money,
+				EquipmentValue: equipmentValue[i][player],
+				MoneySpent:     moneySpent[i][player],
+			}
+		}
+
+		teamAEconomy, teamBEconomy := roundInfo.CTEconomy, roundInfo.TEconomy
+		if teamASide == "T" {
+			teamAEconomy, teamBEconomy = roundInfo.TEconomy, roundInfo.CTEconomy
+		}
+
 		ret = append(ret, RoundOverview{
-			TeamAScore: teamAScore,
-			TeamBScore: teamBScore,
-			TeamASide:  teamASide,
-			TeamBSide:  teamBSide,
-			Events:     events,
+			TeamAScore:   teamAScore,
+			TeamBScore:   teamBScore,
+			TeamASide:    teamASide,
+			TeamBSide:    teamBSide,
+			Events:       events,
+			TeamAEconomy: teamAEconomy,
+			TeamBEconomy: teamBEconomy,
+			Economy:      economy,
+			Clutch:       clutches[i],
 		})
 	}
 
 	return ret
 }
+
+// Flatten the per-round positions into one list, tagging each
+// event with the round it happened in
+func computePositions(positions [][]PositionEvent) []PositionEvent {
+	ret := make([]PositionEvent, 0)
+	for i, round := range positions {
+		for _, position := range round {
+			position.Round = i + 1
+			ret = append(ret, position)
+		}
+	}
+	return ret
+}
@@ -23,30 +23,37 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
 type Config struct {
-	allowDemoDownload bool
-	assetsPath        string
-	dataPath          string
-	dbConnString      string
-	dbType            string
-	debug             bool
-	demosPath         string
-	frontendPath      string
-	jwtSecret         []byte
-	jwtSessionHours   int
-	matchVisibility   string
-	migrationsPath    string
-	port              string
-	rescanInterval    int
-	selfSignupEnabled bool
-	showLoginButton   bool
-	staticPath        string
-	timezone          string
-	trustedProxies    []string
+	allowDemoDownload  bool
+	assetsPath         string
+	dataPath           string
+	dbConnString       string
+	dbType             string
+	debug              bool
+	demosPaths         []string
+	frontendPath       string
+	jwtSecret          []byte
+	jwtSessionHours    int
+	matchVisibility    string
+	maxUploadSizeMb    int
+	parseMaxAttempts   int
+	parseWorkers       int
+	migrationsPath     string
+	overtimeMaxRounds  int
+	port               string
+	ratingUseHltv      bool
+	rescanInterval     int
+	selfSignupEnabled  bool
+	showLoginButton    bool
+	staticPath         string
+	timezone           string
+	tradeWindowSeconds int
+	trustedProxies     []string
 }
 
 // FOR DEVELOPERS: Make sure you update the configuration documentation when adding
@@ -57,13 +64,22 @@ func getConfig() (Config, error) {
 		return Config{}, err
 	}
 
-	if dbType != "postgres" {
-		return Config{}, errors.New("Database type must be \"postgres\".")
+	if dbType != "postgres" && dbType != "sqlite" {
+		return Config{}, errors.New("Database type must be \"postgres\" or \"sqlite\".")
 	}
 
-	dbConnString, err := envStringRequired("PUGGIES_DB_CONNECTION_STRING")
-	if err != nil {
-		return Config{}, err
+	dataPath := envOrString("PUGGIES_DATA_PATH", "/data")
+
+	// The SQLite database is just a file so we can put it in the data
+	// folder if the user doesn't care where it goes
+	var dbConnString string
+	if dbType == "sqlite" {
+		dbConnString = envOrString("PUGGIES_DB_CONNECTION_STRING", join(dataPath, "puggies.db"))
+	} else {
+		dbConnString, err = envStringRequired("PUGGIES_DB_CONNECTION_STRING")
+		if err != nil {
+			return Config{}, err
+		}
 	}
 
 	jwtSecret, err := envStringRequired("PUGGIES_JWT_SECRET")
@@ -81,31 +97,80 @@ func getConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	maxUploadSizeMb, err := envOrNumber("PUGGIES_MAX_UPLOAD_SIZE_MB", 500)
+	if err != nil {
+		return Config{}, err
+	}
+
+	parseWorkers, err := envOrNumber("PUGGIES_PARSE_WORKERS", 2)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if parseWorkers < 1 {
+		return Config{}, errors.New("PUGGIES_PARSE_WORKERS must be at least 1")
+	}
+
+	parseMaxAttempts, err := envOrNumber("PUGGIES_PARSE_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if parseMaxAttempts < 1 {
+		return Config{}, errors.New("PUGGIES_PARSE_MAX_ATTEMPTS must be at least 1")
+	}
+
+	tradeWindowSeconds, err := envOrNumber("PUGGIES_TRADE_WINDOW_SECONDS", 5)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if tradeWindowSeconds < 1 {
+		return Config{}, errors.New("PUGGIES_TRADE_WINDOW_SECONDS must be at least 1")
+	}
+
+	overtimeMaxRounds, err := envOrNumber("PUGGIES_OVERTIME_MAX_ROUNDS", DefaultOvertimeLength)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if overtimeMaxRounds < 2 || overtimeMaxRounds%2 != 0 {
+		return Config{}, errors.New("PUGGIES_OVERTIME_MAX_ROUNDS must be an even number of at least 2")
+	}
+
+	demosPaths := demosPaths()
+
 	matchVisibility, err := matchVisibility()
 	if err != nil {
 		return Config{}, err
 	}
 
 	return Config{
-		allowDemoDownload: envOrBool("PUGGIES_ALLOW_DEMO_DOWNLOAD", true),
-		assetsPath:        envOrString("PUGGIES_ASSETS_PATH", "/backend/assets"),
-		dataPath:          envOrString("PUGGIES_DATA_PATH", "/data"),
-		dbConnString:      dbConnString,
-		dbType:            dbType,
-		debug:             envOrBool("PUGGIES_DEBUG", false),
-		demosPath:         envOrString("PUGGIES_DEMOS_PATH", "/demos"),
-		frontendPath:      envOrString("PUGGIES_FRONTEND_PATH", "/app"),
-		jwtSecret:         []byte(jwtSecret),
-		jwtSessionHours:   jwtSessionHours,
-		matchVisibility:   matchVisibility,
-		migrationsPath:    envOrString("PUGGIES_MIGRATIONS_PATH", "/backend/migrations"),
-		port:              envOrString("PUGGIES_HTTP_PORT", "9115"),
-		rescanInterval:    rescanInterval,
-		selfSignupEnabled: envOrBool("PUGGIES_ALLOW_SELF_SIGNUP", false),
-		showLoginButton:   envOrBool("PUGGIES_SHOW_LOGIN_BUTTON", true),
-		staticPath:        envOrString("PUGGIES_STATIC_PATH", "/frontend/build"),
-		timezone:          envOrString("PUGGIES_TZ", "Etc/UTC"),
-		trustedProxies:    envStringList("PUGGIES_TRUSTED_PROXIES"),
+		allowDemoDownload:  envOrBool("PUGGIES_ALLOW_DEMO_DOWNLOAD", true),
+		assetsPath:         envOrString("PUGGIES_ASSETS_PATH", "/backend/assets"),
+		dataPath:           dataPath,
+		dbConnString:       dbConnString,
+		dbType:             dbType,
+		debug:              envOrBool("PUGGIES_DEBUG", false),
+		demosPaths:         demosPaths,
+		frontendPath:       envOrString("PUGGIES_FRONTEND_PATH", "/app"),
+		jwtSecret:          []byte(jwtSecret),
+		jwtSessionHours:    jwtSessionHours,
+		matchVisibility:    matchVisibility,
+		maxUploadSizeMb:    maxUploadSizeMb,
+		parseMaxAttempts:   parseMaxAttempts,
+		parseWorkers:       parseWorkers,
+		migrationsPath:     envOrString("PUGGIES_MIGRATIONS_PATH", "/backend/migrations"),
+		overtimeMaxRounds:  overtimeMaxRounds,
+		port:               envOrString("PUGGIES_HTTP_PORT", "9115"),
+		ratingUseHltv:      envOrBool("PUGGIES_RATING_USE_HLTV", true),
+		rescanInterval:     rescanInterval,
+		selfSignupEnabled:  envOrBool("PUGGIES_ALLOW_SELF_SIGNUP", false),
+		showLoginButton:    envOrBool("PUGGIES_SHOW_LOGIN_BUTTON", true),
+		staticPath:         envOrString("PUGGIES_STATIC_PATH", "/frontend/build"),
+		timezone:           envOrString("PUGGIES_TZ", "Etc/UTC"),
+		tradeWindowSeconds: tradeWindowSeconds,
+		trustedProxies:     envStringList("PUGGIES_TRUSTED_PROXIES"),
 	}, nil
 }
 
@@ -117,18 +182,24 @@ func (config Config) String() string {
 	ret += "\t" + "dbConnString: [redacted]\n"
 	ret += "\t" + "dbType: " + config.dbType + "\n"
 	ret += "\t" + "debug: " + strconv.FormatBool(config.debug) + "\n"
-	ret += "\t" + "demosPath: " + config.demosPath + "\n"
+	ret += "\t" + "demosPaths: " + strings.Join(config.demosPaths, ", ") + "\n"
 	ret += "\t" + "frontendPath: " + config.frontendPath + "\n"
 	ret += "\t" + "jwtSecret: [redacted]\n"
 	ret += "\t" + "jwtSessionHours: " + strconv.Itoa(config.jwtSessionHours) + "\n"
 	ret += "\t" + "matchVisibility: " + config.matchVisibility + "\n"
+	ret += "\t" + "maxUploadSizeMb: " + strconv.Itoa(config.maxUploadSizeMb) + "\n"
+	ret += "\t" + "parseMaxAttempts: " + strconv.Itoa(config.parseMaxAttempts) + "\n"
+	ret += "\t" + "parseWorkers: " + strconv.Itoa(config.parseWorkers) + "\n"
 	ret += "\t" + "migrationsPath: " + config.migrationsPath + "\n"
+	ret += "\t" + "overtimeMaxRounds: " + strconv.Itoa(config.overtimeMaxRounds) + "\n"
 	ret += "\t" + "port: " + config.port + "\n"
+	ret += "\t" + "ratingUseHltv: " + strconv.FormatBool(config.ratingUseHltv) + "\n"
 	ret += "\t" + "rescanInterval: " + strconv.Itoa(config.rescanInterval) + "\n"
 	ret += "\t" + "selfSignupEnabled: " + strconv.FormatBool(config.selfSignupEnabled) + "\n"
 	ret += "\t" + "showLoginButton: " + strconv.FormatBool(config.showLoginButton) + "\n"
 	ret += "\t" + "staticPath: " + config.staticPath + "\n"
 	ret += "\t" + "timezone: " + config.timezone + "\n"
+	ret += "\t" + "tradeWindowSeconds: " + strconv.Itoa(config.tradeWindowSeconds) + "\n"
 	ret += "\t" + "trustedProxies: " + strings.Join(config.trustedProxies, ", ") + "\n"
 	ret += "}"
 	return ret
@@ -184,6 +255,23 @@ func envStringList(envKey string) []string {
 	return proxies
 }
 
+// The folders that demos are read from. Uploaded demos are saved to the
+// first one
+func demosPaths() []string {
+	var paths []string
+	for _, path := range envStringList("PUGGIES_DEMOS_PATH") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+
+	if len(paths) == 0 {
+		return []string{"/demos"}
+	}
+	return paths
+}
+
 func matchVisibility() (string, error) {
 	val := envOrString("PUGGIES_MATCH_VISIBILITY", "public")
 	if val != "public" && val != "private" {
@@ -23,6 +23,8 @@ package main
 type Context struct {
 	config Config
 	db     Storage
+	events *EventBroker
+	jobs   *JobQueue
 	logger *Logger
 }
 
@@ -36,11 +38,21 @@ func getContext(config Config, logger *Logger) (Context, error) {
 			return Context{}, err
 		}
 		db = pg
+	case "sqlite":
+		sqlite, err := newSqliteDb(config, logger)
+		if err != nil {
+			return Context{}, err
+		}
+		db = sqlite
 	}
 
+	events := newEventBroker()
+
 	return Context{
 		config: config,
 		db:     db,
+		events: events,
+		jobs:   newJobQueue(db, events, config.demosPaths),
 		logger: logger,
 	}, nil
 }
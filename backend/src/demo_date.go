@@ -0,0 +1,138 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msg"
+)
+
+const (
+	// Where the date of a match came from
+	DateSourceFileName  = "filename"
+	DateSourceMatchInfo = "matchinfo"
+	DateSourceModified  = "modified"
+	DateSourceParsed    = "parsed"
+	// Set by an admin, only ever returned from the database
+	DateSourceOverride = "override"
+
+	// Same as the sane_date constraint on the matches table (2012-01-01)
+	MinDemoTimestamp = 1325376000000
+)
+
+var (
+	DateRegex1 = regexp.MustCompile(`(\d\d\d\d)-(\d\d)-(\d\d)`)
+	DateRegex2 = regexp.MustCompile(`(\d\d\d\d)_(\d\d)_(\d\d)`)
+	DateRegex3 = regexp.MustCompile(`(\d\d\d\d)/(\d\d)/(\d\d)`)
+)
+
+// Works out when the match in the demo was played and where we got that
+// from. In order of preference:
+//
+//   - A date in the file name, since that's how most servers name demos
+//   - The match time in the .dem.info file that Valve's servers put next
+//     to matchmaking demos
+//   - The modification time of the demo file
+//
+// If none of those work we fall back to the current time. The result
+// doesn't depend on the demo contents so it can be recomputed without
+// parsing the demo again
+func getDemoTime(config Config, logger *Logger, path string) (time.Time, string) {
+	if t, ok := getFileNameTime(config, logger, getDemoFileName(path)); ok {
+		return t, DateSourceFileName
+	}
+
+	// The match info stays uncompressed next to the demo. We don't look
+	// inside archives for it
+	if _, _, inArchive := splitArchivePath(path); !inArchive {
+		demoPath, _ := trimCompressionExt(path)
+		if t, err := getMatchInfoTime(demoPath + ".info"); err == nil {
+			return t, DateSourceMatchInfo
+		} else if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("failed to read match info for %s: %s", path, err.Error())
+		}
+	}
+
+	if t, err := demoModTime(path); err == nil && t.UnixMilli() >= MinDemoTimestamp {
+		return t, DateSourceModified
+	}
+
+	return time.Now(), DateSourceParsed
+}
+
+func getFileNameTime(config Config, logger *Logger, demoFileName string) (time.Time, bool) {
+	matches := DateRegex1.FindStringSubmatch(demoFileName)
+	if matches == nil {
+		matches = DateRegex2.FindStringSubmatch(demoFileName)
+	}
+
+	if matches == nil {
+		matches = DateRegex3.FindStringSubmatch(demoFileName)
+	}
+
+	if matches == nil {
+		return time.Time{}, false
+	}
+
+	// TODO: should probably come back to this and be a
+	// little smarter about which matched field is the day
+	// and which is the month
+	loc, err := time.LoadLocation(config.timezone)
+	if err != nil {
+		logger.Errorf("failed to load timezone: %s", err.Error())
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", matches[1]+"-"+matches[2]+"-"+matches[3], loc)
+	if err != nil {
+		logger.Errorf("failed to parse time: %s", err.Error())
+		return time.Time{}, false
+	}
+
+	return t, t.UnixMilli() >= MinDemoTimestamp
+}
+
+// The .dem.info file is a protobuf message from the game coordinator.
+// The match time in it is a Unix timestamp in seconds
+func getMatchInfoTime(path string) (time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info := new(msg.CDataGCCStrike15V2_MatchInfo)
+	err = proto.Unmarshal(b, info)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t := time.Unix(int64(info.GetMatchtime()), 0)
+	if t.UnixMilli() < MinDemoTimestamp {
+		return time.Time{}, errors.New("match info has no match time")
+	}
+
+	return t, nil
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Demos can be stored compressed or inside zip archives to save space. A
+// demo inside an archive is referred to by the path of the archive followed
+// by the name of the demo within it, e.g. /demos/week1.zip/pug_mirage.dem
+const (
+	DemoExt        = ".dem"
+	DemoArchiveExt = ".zip"
+)
+
+var DemoCompressionExts = []string{".gz", ".bz2", ".zst"}
+
+// Strips the compression extension (if any) from the file name
+func trimCompressionExt(name string) (string, string) {
+	for _, ext := range DemoCompressionExts {
+		if strings.HasSuffix(name, DemoExt+ext) {
+			return strings.TrimSuffix(name, ext), ext
+		}
+	}
+	return name, ""
+}
+
+// Whether the file is a demo, compressed or not
+func isDemoFile(path string) bool {
+	name, _ := trimCompressionExt(path)
+	return strings.HasSuffix(name, DemoExt)
+}
+
+func isDemoArchive(path string) bool {
+	return strings.HasSuffix(path, DemoArchiveExt)
+}
+
+// Whether we should look at the file when scanning the demos folder
+func isDemoSource(path string) bool {
+	return isDemoFile(path) || isDemoArchive(path)
+}
+
+// Splits the path of a demo inside an archive into the path of the archive
+// and the name of the demo within it. Only a .zip that's a file counts as
+// an archive, so folders with names ending in .zip work like any other
+// folder. ok is false if the demo isn't in an archive
+func splitArchivePath(path string) (archive string, member string, ok bool) {
+	sep := DemoArchiveExt + "/"
+	start := 0
+	for {
+		i := strings.Index(path[start:], sep)
+		if i == -1 {
+			return path, "", false
+		}
+
+		end := start + i + len(DemoArchiveExt)
+		info, err := os.Stat(path[:end])
+		if err == nil && info.Mode().IsRegular() {
+			return path[:end], path[end+1:], true
+		}
+
+		start = end + 1
+	}
+}
+
+// Returns the paths of all of the demos in the given file. That's the
+// demos inside it for archives, otherwise it's just the file itself
+func listDemos(path string) ([]string, error) {
+	if !isDemoArchive(path) {
+		return []string{path}, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var demos []string
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() && isDemoFile(f.Name) {
+			demos = append(demos, path+"/"+f.Name)
+		}
+	}
+
+	return demos, nil
+}
+
+// A demo's decompressed contents along with everything that needs to be
+// closed once we're done with it
+type demoReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *demoReader) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		err = errors.Join(err, d.closers[i].Close())
+	}
+	return err
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// Opens the demo at the given path, which may be compressed or inside an
+// archive. onProgress is optional. If it's provided it's called with the
+// percentage of the file that has been read so far
+func openDemo(path string, onProgress func(int)) (io.ReadCloser, error) {
+	d := &demoReader{}
+
+	var size int64
+	archivePath, member, inArchive := splitArchivePath(path)
+	if inArchive {
+		archive, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		d.closers = append(d.closers, archive)
+
+		f, err := findArchiveMember(archive, member)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.closers = append(d.closers, r)
+		d.Reader = r
+		size = int64(f.UncompressedSize64)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		d.closers = append(d.closers, f)
+		d.Reader = f
+
+		info, err := f.Stat()
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		size = info.Size()
+	}
+
+	// Progress is measured before decompressing since we don't know
+	// how big the demo is until we've decompressed all of it
+	if onProgress != nil {
+		d.Reader = &progressReader{r: d.Reader, total: size, onProgress: onProgress}
+	}
+
+	_, ext := trimCompressionExt(path)
+	switch ext {
+	case ".gz":
+		r, err := gzip.NewReader(d.Reader)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.closers = append(d.closers, r)
+		d.Reader = r
+	case ".bz2":
+		d.Reader = bzip2.NewReader(d.Reader)
+	case ".zst":
+		r, err := zstd.NewReader(d.Reader)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.closers = append(d.closers, closerFunc(func() error {
+			r.Close()
+			return nil
+		}))
+		d.Reader = r
+	}
+
+	return d, nil
+}
+
+func findArchiveMember(archive *zip.ReadCloser, member string) (*zip.File, error) {
+	for _, f := range archive.File {
+		if f.Name == member {
+			return f, nil
+		}
+	}
+	return nil, errors.New("demo " + member + " not found in archive")
+}
+
+// When the demo was last modified. For demos inside an archive this is
+// the time recorded in the archive rather than the time of the archive
+func demoModTime(path string) (time.Time, error) {
+	archivePath, member, inArchive := splitArchivePath(path)
+	if !inArchive {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer archive.Close()
+
+	f, err := findArchiveMember(archive, member)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return f.Modified, nil
+}
+
+// Which of the demo folders the demo is in and its path relative to that
+// folder, which is what gets stored with the match. ok is false for demos
+// outside of the demo folders (when using the parse command), which are
+// stored under the first folder with just their file name
+func locateDemo(demosPaths []string, path string) (root int, rel string, ok bool) {
+	for i, demosPath := range demosPaths {
+		rel, err := filepath.Rel(demosPath, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return i, filepath.ToSlash(rel), true
+		}
+	}
+	return 0, filepath.Base(path), false
+}
+
+// The match ID for the demo. Uncompressed demos directly inside the first
+// demo folder are named after the file. Anything else gets a suffix based
+// on where the demo is so that demos with the same name in different
+// folders or archives, or compressed and uncompressed copies of the same
+// demo, don't end up as the same match
+func getDemoId(demosPaths []string, path string) string {
+	name := getDemoFileName(path)
+	root, rel, ok := locateDemo(demosPaths, path)
+	if !ok || (root == 0 && rel == name+DemoExt) {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(strconv.Itoa(root) + ":" + rel))
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Returns every file in the folder and its subfolders that could contain
+// demos. Hidden folders are skipped
+func findDemoSources(dir string) ([]string, error) {
+	var sources []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isDemoSource(path) {
+			sources = append(sources, path)
+		}
+		return nil
+	})
+
+	return sources, err
+}
+
+// The route that the demo folder is served from when demo downloads are
+// enabled. The first folder keeps the original route
+func demoDownloadRoute(root int) string {
+	if root == 0 {
+		return "/demos"
+	}
+	return "/demos-" + strconv.Itoa(root)
+}
+
+// Where the demo can be downloaded from. Demos inside an archive are
+// downloaded as the whole archive
+func demoDownloadLink(demosPaths []string, root int, demoPath string) string {
+	if root < len(demosPaths) {
+		_, member, inArchive := splitArchivePath(join(demosPaths[root], demoPath))
+		if inArchive {
+			demoPath = strings.TrimSuffix(demoPath, "/"+member)
+		}
+	}
+	return "/api/v1" + demoDownloadRoute(root) + "/" + demoPath
+}
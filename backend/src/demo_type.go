@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	DemoTypeEsea     = "esea"
+	DemoTypePugSetup = "pugsetup"
+	DemoTypeFaceit   = "faceit"
+	DemoTypeSteam    = "steam"
+
+	// How much each kind of evidence counts towards a demo type. The file
+	// name is only a fallback since people rename their demos
+	DemoTypeWeightServerName = 0.9
+	DemoTypeWeightConVar     = 0.8
+	DemoTypeWeightChat       = 0.7
+	DemoTypeWeightFileName   = 0.4
+)
+
+// Markers that show up in server names, ConVar names and server chat
+// messages, in order of precedence
+var demoTypeMarkers = []struct {
+	demoType string
+	markers  []string
+}{
+	{DemoTypeEsea, []string{"esea"}},
+	{DemoTypeFaceit, []string{"faceit"}},
+	{DemoTypePugSetup, []string{"pugsetup", "pug setup"}},
+	{DemoTypeSteam, []string{"valve"}},
+}
+
+// Works out where a demo came from using whatever the demo tells us while
+// it's being parsed. Each source of evidence is only counted once so the
+// same detector can be reused if the demo has to be parsed again
+type demoTypeDetector struct {
+	// Weight of each piece of evidence, keyed by source and then demo type
+	evidence map[string]map[string]float64
+}
+
+func newDemoTypeDetector(demoFileName string) *demoTypeDetector {
+	d := &demoTypeDetector{evidence: make(map[string]map[string]float64)}
+
+	if strings.HasPrefix(demoFileName, "esea") {
+		d.add("filename", DemoTypeEsea, DemoTypeWeightFileName)
+	} else if strings.HasPrefix(demoFileName, "pug_") {
+		d.add("filename", DemoTypePugSetup, DemoTypeWeightFileName)
+	} else if strings.HasPrefix(demoFileName, "1-") {
+		d.add("filename", DemoTypeFaceit, DemoTypeWeightFileName)
+	} else if strings.HasPrefix(demoFileName, "match730_") {
+		d.add("filename", DemoTypeSteam, DemoTypeWeightFileName)
+	}
+
+	return d
+}
+
+func (d *demoTypeDetector) add(source, demoType string, weight float64) {
+	if d.evidence[source] == nil {
+		d.evidence[source] = make(map[string]float64)
+	}
+	d.evidence[source][demoType] = weight
+}
+
+// Returns the demo type whose marker appears in text, if any
+func matchDemoTypeMarker(text string) string {
+	text = strings.ToLower(text)
+	for _, m := range demoTypeMarkers {
+		for _, marker := range m.markers {
+			if strings.Contains(text, marker) {
+				return m.demoType
+			}
+		}
+	}
+	return ""
+}
+
+// The server's hostname, e.g. "ESEA Premier Server #12" or "Valve
+// Counter-Strike 2 us_east Server"
+func (d *demoTypeDetector) onServerName(name string) {
+	if demoType := matchDemoTypeMarker(name); demoType != "" {
+		d.add("servername", demoType, DemoTypeWeightServerName)
+	}
+}
+
+// Plugins tend to register ConVars prefixed with their own name, so
+// we only look at the names and not the values
+func (d *demoTypeDetector) onConVars(conVars map[string]string) {
+	for name := range conVars {
+		demoType := matchDemoTypeMarker(name)
+		if demoType != "" && demoType != DemoTypeSteam {
+			d.add("convar", demoType, DemoTypeWeightConVar)
+		}
+	}
+}
+
+// Only messages printed by the server count. Players talking about
+// ESEA in all chat shouldn't change anything
+func (d *demoTypeDetector) onServerMessage(text string) {
+	demoType := matchDemoTypeMarker(text)
+	if demoType != "" && demoType != DemoTypeSteam {
+		d.add("chat", demoType, DemoTypeWeightChat)
+	}
+}
+
+// The detected demo type and how confident we are in it from 0 to 1. The
+// confidence is the strongest piece of evidence for the type, scaled down
+// by how much of the evidence disagreed with it. Demos without any evidence
+// are assumed to be matchmaking demos with a confidence of 0
+func (d *demoTypeDetector) result() (string, float64) {
+	totals := make(map[string]float64)
+	strongest := make(map[string]float64)
+	total := 0.0
+	for _, weights := range d.evidence {
+		for demoType, weight := range weights {
+			totals[demoType] += weight
+			strongest[demoType] = max(strongest[demoType], weight)
+			total += weight
+		}
+	}
+
+	best := DemoTypeSteam
+	for _, m := range demoTypeMarkers {
+		if totals[m.demoType] > totals[best] {
+			best = m.demoType
+		}
+	}
+
+	if total == 0 {
+		return best, 0
+	}
+
+	confidence := strongest[best] * totals[best] / total
+	return best, math.Round(confidence*100) / 100
+}
+
+func (d *demoTypeDetector) demoType() string {
+	demoType, _ := d.result()
+	return demoType
+}
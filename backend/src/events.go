@@ -0,0 +1,100 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	EventRescanStarted  = "rescan_started"
+	EventRescanFinished = "rescan_finished"
+	EventDemoDiscovered = "demo_discovered"
+	EventDemoRenamed    = "demo_renamed"
+	EventDemoQueued     = "demo_queued"
+	EventParseStarted   = "parse_started"
+	EventParseProgress  = "parse_progress"
+	EventParseCompleted = "parse_completed"
+	EventParseFailed    = "parse_failed"
+
+	// Events are dropped for subscribers that fall this far behind
+	EventSubscriberBuffer = 64
+
+	EventKeepAliveInterval = 30 * time.Second
+)
+
+// Something that happened in the background that the frontend might want
+// to show, e.g. the progress of a demo being parsed
+type ServerEvent struct {
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	DemoId    string `json:"demoId,omitempty"`
+	// only set for demo_renamed
+	NewDemoId string `json:"newDemoId,omitempty"`
+	JobId     string `json:"jobId,omitempty"`
+	// what started the rescan (api, cron)
+	Trigger string `json:"trigger,omitempty"`
+	// percentage from 0 to 100, only set for parse_progress
+	Progress int    `json:"progress,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Fans out server events to everyone listening on the events endpoint
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan ServerEvent]struct{}
+}
+
+func newEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan ServerEvent]struct{})}
+}
+
+func (b *EventBroker) Subscribe() chan ServerEvent {
+	ch := make(chan ServerEvent, EventSubscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+func (b *EventBroker) Unsubscribe(ch chan ServerEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// Send the event to every subscriber. This never blocks -- if a
+// subscriber isn't keeping up it just misses the event
+func (b *EventBroker) Publish(event ServerEvent) {
+	event.Timestamp = time.Now().UnixMilli()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -31,6 +31,16 @@ func filterByLiveRoundsInt(data []PlayerIntMap, isLive []bool) []PlayerIntMap {
 	return ret
 }
 
+func filterByLiveRoundsWeapons(data []PlayerWeaponMap, isLive []bool) []PlayerWeaponMap {
+	var ret []PlayerWeaponMap
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
 func filterByLiveRoundsOpeningKill(data []*OpeningKill, isLive []bool) []*OpeningKill {
 	var ret []*OpeningKill
 	for i, live := range isLive {
@@ -41,6 +51,56 @@ func filterByLiveRoundsOpeningKill(data []*OpeningKill, isLive []bool) []*Openin
 	return ret
 }
 
+func filterByLiveRoundsClutch(data []*Clutch, isLive []bool) []*Clutch {
+	var ret []*Clutch
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsTrades(data [][]Trade, isLive []bool) [][]Trade {
+	var ret [][]Trade
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsPositions(data [][]PositionEvent, isLive []bool) [][]PositionEvent {
+	var ret [][]PositionEvent
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsGrenades(data [][]*Grenade, isLive []bool) [][]*Grenade {
+	var ret [][]*Grenade
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func filterByLiveRoundsFrames(data [][]ReplayFrame, isLive []bool) [][]ReplayFrame {
+	var ret [][]ReplayFrame
+	for i, live := range isLive {
+		if live {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
 func filterByLiveRoundsH2H(data []map[uint64]map[uint64]Kill, isLive []bool) []map[uint64]map[uint64]Kill {
 	var ret []map[uint64]map[uint64]Kill
 	for i, live := range isLive {
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+
+	r2 "github.com/golang/geo/r2"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+)
+
+const (
+	GrenadeFlash   = "flash"
+	GrenadeHE      = "he"
+	GrenadeSmoke   = "smoke"
+	GrenadeMolotov = "molotov"
+	GrenadeDecoy   = "decoy"
+
+	// Trajectory points closer than this many radar pixels to the
+	// previous one are dropped to keep the utility data small
+	GrenadeTrajectoryStep = 5
+)
+
+type RadarPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// A grenade thrown during a round. Positions are in radar image pixels
+// and times are milliseconds since the start of the round
+type Grenade struct {
+	Thrower uint64 `json:"thrower,string"`
+	Side    string `json:"side"`
+	Kind    string `json:"kind"`
+
+	ThrowTime    int64        `json:"throwTime"`
+	DetonateTime int64        `json:"detonateTime"`
+	Throw        RadarPoint   `json:"throw"`
+	Land         RadarPoint   `json:"land"`
+	Trajectory   []RadarPoint `json:"trajectory"`
+
+	// How many milliseconds each player was blinded for by a flash
+	Blinded PlayerIntMap `json:"blinded,omitempty"`
+	// Health damage done to each enemy by an HE or molotov
+	Damage PlayerIntMap `json:"damage,omitempty"`
+
+	landed bool
+}
+
+func grenadeKind(weapon common.EquipmentType) string {
+	switch weapon {
+	case common.EqFlash:
+		return GrenadeFlash
+	case common.EqHE:
+		return GrenadeHE
+	case common.EqSmoke:
+		return GrenadeSmoke
+	case common.EqMolotov, common.EqIncendiary:
+		return GrenadeMolotov
+	case common.EqDecoy:
+		return GrenadeDecoy
+	}
+	return ""
+}
+
+func toRadarPoint(mapMetadata metadata.Map, x, y float64) RadarPoint {
+	radarX, radarY := mapMetadata.TranslateScale(x, y)
+	return RadarPoint{X: int(math.Round(radarX)), Y: int(math.Round(radarY))}
+}
+
+// Convert the in-game trajectory to radar pixels, skipping points that
+// are too close together to make a difference on the minimap
+func toRadarTrajectory(mapMetadata metadata.Map, trajectory []r2.Point) []RadarPoint {
+	ret := make([]RadarPoint, 0)
+	for i, point := range trajectory {
+		radarPoint := toRadarPoint(mapMetadata, point.X, point.Y)
+		if len(ret) != 0 && i != len(trajectory)-1 {
+			last := ret[len(ret)-1]
+			dist := math.Hypot(float64(radarPoint.X-last.X), float64(radarPoint.Y-last.Y))
+			if dist < GrenadeTrajectoryStep {
+				continue
+			}
+		}
+		ret = append(ret, radarPoint)
+	}
+	return ret
+}
+
+func computeUtility(grenades [][]*Grenade) [][]Grenade {
+	ret := make([][]Grenade, 0, len(grenades))
+	for _, round := range grenades {
+		roundGrenades := make([]Grenade, 0, len(round))
+		for _, grenade := range round {
+			roundGrenades = append(roundGrenades, *grenade)
+		}
+		ret = append(ret, roundGrenades)
+	}
+	return ret
+}
@@ -20,16 +20,19 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
 	"os"
-	"strings"
+	"path/filepath"
 
 	heatmap "github.com/dustin/go-heatmap"
 	schemes "github.com/dustin/go-heatmap/schemes"
 	r2 "github.com/golang/geo/r2"
-	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
 
 const (
@@ -38,35 +41,155 @@ const (
 	jpegQuality = 90
 )
 
-func getHeatmapFileName(demoPath string, dataSet string) string {
-	return strings.Replace(demoPath[strings.LastIndex(demoPath, "/")+1:], ".dem", "-"+dataSet+".png", 1)
+// The heatmaps that get generated as soon as a match is parsed. Any other
+// filter combination is rendered when it's first requested
+var HeatmapDataSets = map[string]HeatmapFilter{
+	"shotsFired": {Kind: PositionShot},
+	"kills":      {Kind: PositionKill},
+	"deaths":     {Kind: PositionDeath},
+	"grenades":   {Kind: PositionGrenade},
+	"plants":     {Kind: PositionPlant},
 }
 
-func genHeatmap(points []r2.Point,
-	header common.DemoHeader,
-	outPath, mapsPath string,
-) error {
-	// Find bounding rectangle for points to get around the normalization done by the heatmap library
-	r2Bounds := r2.RectFromPoints(points...)
-	padding := float64(dotSize) / 2.0 // Calculating padding amount to avoid shrinkage by the heatmap library
-	bounds := image.Rectangle{
-		Min: image.Point{X: int(r2Bounds.X.Lo - padding), Y: int(r2Bounds.Y.Lo - padding)},
-		Max: image.Point{X: int(r2Bounds.X.Hi + padding), Y: int(r2Bounds.Y.Hi + padding)},
+func isPositionKind(kind string) bool {
+	switch kind {
+	case PositionShot, PositionKill, PositionDeath, PositionGrenade, PositionPlant:
+		return true
 	}
+	return false
+}
 
-	// Transform r2.Points into heatmap.DataPoints
-	var data []heatmap.DataPoint
-	for _, p := range points[1:] {
-		// Invert Y since go-heatmap expects data to be ordered from bottom to top
-		data = append(data, heatmap.P(p.X, p.Y*-1))
+// Used as the file name for the cached heatmap image so the same
+// filter always maps to the same file
+func (f HeatmapFilter) hash() string {
+	key := fmt.Sprintf("%s|%d|%s|%d|%d", f.Kind, f.Player, f.Side, f.FromRound, f.ToRound)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (f HeatmapFilter) matches(position PositionEvent) bool {
+	return (f.Kind == "" || position.Kind == f.Kind) &&
+		(f.Player == 0 || position.Player == f.Player) &&
+		(f.Side == "" || position.Side == f.Side) &&
+		(f.FromRound == 0 || position.Round >= f.FromRound) &&
+		(f.ToRound == 0 || position.Round <= f.ToRound)
+}
+
+func filterPositions(positions []PositionEvent, filter HeatmapFilter) []r2.Point {
+	points := make([]r2.Point, 0)
+	for _, position := range positions {
+		if filter.matches(position) {
+			points = append(points, r2.Point{X: position.X, Y: position.Y})
+		}
+	}
+	return points
+}
+
+// Each match gets its own folder of heatmaps so they can all be
+// cleared or moved at once
+func getHeatmapDir(heatmapsDir, matchId string) string {
+	return join(heatmapsDir, matchId)
+}
+
+func getHeatmapPath(heatmapsDir, matchId string, filter HeatmapFilter) string {
+	return join(getHeatmapDir(heatmapsDir, matchId), filter.hash()+".jpg")
+}
+
+// Render the default data sets for a freshly parsed match. Any heatmaps
+// cached from a previous parse are thrown away first since they might be
+// out of date. A failure to render one data set won't stop the others
+func genHeatmaps(match Match, heatmapsDir, mapsPath string, logger *Logger) error {
+	dir := getHeatmapDir(heatmapsDir, match.Meta.Id)
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	// No positions are recorded for maps without metadata
+	if _, ok := getMapMetadata(match.Meta.Map); !ok {
+		return nil
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for dataSet, filter := range HeatmapDataSets {
+		outPath := getHeatmapPath(heatmapsDir, match.Meta.Id, filter)
+		err = genHeatmap(filterPositions(match.Positions, filter), match.Meta.Map, outPath, mapsPath)
+		if err != nil {
+			logger.Warnf(
+				"demo=%s dataSet=%s failed to generate heatmap: %s",
+				match.Meta.Id,
+				dataSet,
+				err.Error(),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Returns the path to the heatmap for the given filter, rendering it first
+// if it isn't cached yet. Returns an empty string if the match doesn't exist
+// or there's no heatmap for its map
+func getOrGenHeatmap(c Context, matchId string, filter HeatmapFilter) (string, error) {
+	heatmapsDir := join(c.config.dataPath, "heatmaps")
+	outPath := getHeatmapPath(heatmapsDir, matchId, filter)
+	if _, err := os.Stat(outPath); err == nil {
+		return outPath, nil
+	}
+
+	match, err := c.db.GetMatch(matchId)
+	if err != nil || match == nil {
+		return "", err
+	}
+
+	if _, ok := getMapMetadata(match.Meta.Map); !ok {
+		return "", nil
 	}
 
+	positions, err := c.db.GetMatchPositions(matchId)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(getHeatmapDir(heatmapsDir, matchId), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	mapsPath := join(c.config.assetsPath, "minimaps")
+	err = genHeatmap(filterPositions(positions, filter), match.Meta.Map, outPath, mapsPath)
+	if err != nil {
+		return "", err
+	}
+
+	return outPath, nil
+}
+
+// Move the heatmaps for a match when it gets renamed so that
+// they can still be found with the new ID
+func renameHeatmaps(heatmapsDir, oldId, newId string) error {
+	err := os.Rename(getHeatmapDir(heatmapsDir, oldId), getHeatmapDir(heatmapsDir, newId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func genHeatmap(points []r2.Point,
+	mapName string,
+	outPath, mapsPath string,
+) error {
 	// Load map overview image
-	mapPath := join(mapsPath, header.MapName+".jpg")
+	mapPath := join(mapsPath, mapName+".jpg")
 	fMap, err := os.Open(mapPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("no overview image for map %s", mapName)
 	}
+	defer fMap.Close()
 
 	imgMap, _, err := image.Decode(fMap)
 	if err != nil {
@@ -77,19 +200,45 @@ func genHeatmap(points []r2.Point,
 	img := image.NewRGBA(imgMap.Bounds())
 	draw.Draw(img, imgMap.Bounds(), imgMap, image.Point{}, draw.Over)
 
-	// Generate and draw heatmap overlay on top of the overview
-	imgHeatmap := heatmap.Heatmap(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), data, dotSize, opacity, schemes.AlphaFire)
-	draw.Draw(img, bounds, imgHeatmap, image.Point{}, draw.Over)
+	// An empty heatmap is just the overview on its own
+	if len(points) != 0 {
+		drawHeatmap(img, points)
+	}
 
-	outf, err := os.OpenFile(outPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Write to a temporary file first so that nobody can be served a
+	// half-written image if the same heatmap is requested twice at once
+	outf, err := os.CreateTemp(filepath.Dir(outPath), "heatmap-*.tmp")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(outf.Name())
 
 	err = jpeg.Encode(outf, img, &jpeg.Options{Quality: jpegQuality})
+	outf.Close()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(outf.Name(), outPath)
+}
+
+func drawHeatmap(img *image.RGBA, points []r2.Point) {
+	// Find bounding rectangle for points to get around the normalization done by the heatmap library
+	r2Bounds := r2.RectFromPoints(points...)
+	padding := float64(dotSize) / 2.0 // Calculating padding amount to avoid shrinkage by the heatmap library
+	bounds := image.Rectangle{
+		Min: image.Point{X: int(r2Bounds.X.Lo - padding), Y: int(r2Bounds.Y.Lo - padding)},
+		Max: image.Point{X: int(r2Bounds.X.Hi + padding), Y: int(r2Bounds.Y.Hi + padding)},
+	}
+
+	// Transform r2.Points into heatmap.DataPoints
+	var data []heatmap.DataPoint
+	for _, p := range points {
+		// Invert Y since go-heatmap expects data to be ordered from bottom to top
+		data = append(data, heatmap.P(p.X, p.Y*-1))
+	}
+
+	// Generate and draw heatmap overlay on top of the overview
+	imgHeatmap := heatmap.Heatmap(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), data, dotSize, opacity, schemes.AlphaFire)
+	draw.Draw(img, bounds, imgHeatmap, image.Point{}, draw.Over)
 }
@@ -0,0 +1,258 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	// Finished jobs are removed from the database after this long
+	JobRetentionHours = 24
+
+	// How often idle workers check the queue in case they missed a wakeup
+	JobPollInterval = time.Minute
+
+	// Failed jobs wait this long before their first retry, doubling
+	// with each attempt after that up to the maximum
+	JobRetryBaseDelay = 30 * time.Second
+	JobRetryMaxDelay  = 30 * time.Minute
+)
+
+type Job struct {
+	Id        string `json:"id"`
+	DemoId    string `json:"demoId"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Attempts  int    `json:"attempts"`
+	Username  string `json:"username,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+	// When a failed job will be tried again, see jobRetryDelay
+	RetryAt int64 `json:"retryAt,omitempty"`
+
+	// The path is stored in the database but we don't want to leak the
+	// server's folder structure through the API
+	Path string `json:"-"`
+}
+
+func isJobStatus(status string) bool {
+	switch status {
+	case JobQueued, JobRunning, JobDone, JobFailed:
+		return true
+	}
+	return false
+}
+
+// Demos waiting to be parsed. The queue itself lives in the database so
+// that it survives restarts, this just wakes up the workers when a new
+// job is added
+type JobQueue struct {
+	// Held while adding a job so the same demo can't be queued twice
+	mu     sync.Mutex
+	db     Storage
+	events *EventBroker
+	wakeup chan struct{}
+	// Needed to work out the match IDs of the queued demos
+	demosPaths []string
+	// Set when a job finishes. The ratings are recomputed once the queue
+	// is empty rather than after every demo
+	ratingsStale atomic.Bool
+}
+
+func newJobQueue(db Storage, events *EventBroker, demosPaths []string) *JobQueue {
+	return &JobQueue{
+		db:         db,
+		events:     events,
+		wakeup:     make(chan struct{}, 1),
+		demosPaths: demosPaths,
+	}
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Add the demo to the queue. If the demo is already waiting to be parsed
+// the existing job is returned instead of creating a new one
+func (q *JobQueue) Enqueue(path, username string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	latest, err := q.db.GetLatestJob(path)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if latest != nil && (latest.Status == JobQueued || latest.Status == JobRunning) {
+		return *latest, nil
+	}
+
+	id, err := newJobId()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UnixMilli()
+	job := Job{
+		Id:        id,
+		DemoId:    getDemoId(q.demosPaths, path),
+		Status:    JobQueued,
+		Username:  username,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Path:      path,
+	}
+
+	err = q.db.InsertJob(job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.events.Publish(ServerEvent{Type: EventDemoQueued, DemoId: job.DemoId, JobId: job.Id})
+	q.notify()
+	return job, nil
+}
+
+// Wake up one idle worker. Doesn't block if all of the workers are busy
+func (q *JobQueue) notify() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// How long to wait before trying a job again after it failed the given
+// number of times
+func jobRetryDelay(attempts int) time.Duration {
+	delay := JobRetryBaseDelay
+	for i := 1; i < attempts && delay < JobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, JobRetryMaxDelay)
+}
+
+func runJobWorkers(c Context) {
+	// If the server was stopped in the middle of a parse the job will
+	// still be marked as running
+	err := c.db.RequeueRunningJobs()
+	if err != nil {
+		c.logger.Errorf("failed to requeue interrupted parse jobs: %s", err.Error())
+	}
+
+	c.logger.Infof("starting %d parse workers", c.config.parseWorkers)
+	for i := 0; i < c.config.parseWorkers; i++ {
+		go runJobWorker(i, c)
+	}
+
+	c.jobs.notify()
+}
+
+func runJobWorker(worker int, c Context) {
+	ticker := time.NewTicker(JobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.db.ClaimJob()
+		if err != nil {
+			c.logger.Errorf("worker=%d failed to fetch next parse job: %s", worker, err.Error())
+		}
+
+		if job == nil {
+			if c.jobs.ratingsStale.Swap(false) {
+				updateRatings("parse", c)
+			}
+
+			select {
+			case <-c.jobs.wakeup:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		// There might be more jobs waiting so pass the wakeup along to
+		// the next idle worker
+		c.jobs.notify()
+		runJob(worker, *job, c)
+	}
+}
+
+func runJob(worker int, job Job, c Context) {
+	c.logger.Infof(
+		"worker=%d job=%s demo=%s attempt=%d starting parse job",
+		worker,
+		job.Id,
+		job.DemoId,
+		job.Attempts,
+	)
+
+	err := parseIdempotent(job.Path, join(c.config.dataPath, "heatmaps"), false, c)
+	job.UpdatedAt = time.Now().UnixMilli()
+
+	if err == nil {
+		c.logger.Infof("worker=%d job=%s demo=%s parse job finished", worker, job.Id, job.DemoId)
+		job.Status = JobDone
+		job.Error = ""
+		c.jobs.ratingsStale.Store(true)
+	} else {
+		job.Error = fmt.Sprintf("Failed to parse demo: %s", err.Error())
+		c.logger.Errorf("worker=%d job=%s demo=%s %s", worker, job.Id, job.DemoId, job.Error)
+
+		if job.Attempts < c.config.parseMaxAttempts {
+			job.Status = JobQueued
+			job.RetryAt = job.UpdatedAt + jobRetryDelay(job.Attempts).Milliseconds()
+		} else {
+			job.Status = JobFailed
+		}
+	}
+
+	err = c.db.UpdateJob(job)
+	if err != nil {
+		c.logger.Errorf(
+			"worker=%d job=%s demo=%s failed to update parse job: %s",
+			worker,
+			job.Id,
+			job.DemoId,
+			err.Error(),
+		)
+	}
+
+	// Wake up a worker once the job can be tried again
+	if job.Status == JobQueued {
+		delay := time.Until(time.UnixMilli(job.RetryAt))
+		c.logger.Infof("worker=%d job=%s demo=%s retrying parse job in %s", worker, job.Id, job.DemoId, delay.Round(time.Second))
+		time.AfterFunc(delay, c.jobs.notify)
+	}
+}
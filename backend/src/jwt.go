@@ -45,7 +45,34 @@ func createJwt(c Context, user User) (string, error) {
 	return tokenString, err
 }
 
+const (
+	// Tokens for the event stream have to go in the URL since browsers
+	// can't set headers on EventSource connections, so they only work for
+	// the event stream and only long enough to connect with
+	JwtScopeEvents     = "events"
+	EventTokenLifetime = time.Minute
+)
+
+func createEventsJwt(c Context, username string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"scope":    JwtScopeEvents,
+		"exp":      now.Add(EventTokenLifetime).Unix(),
+		"iat":      now.Unix(),
+	})
+
+	tokenString, err := token.SignedString(c.config.jwtSecret)
+	return tokenString, err
+}
+
 func validateJwt(c Context, jwtString string) (string, int64, error) {
+	return validateScopedJwt(c, jwtString, "")
+}
+
+// Like validateJwt, but the token has to have been created for the given
+// scope. Session tokens don't have a scope
+func validateScopedJwt(c Context, jwtString, scope string) (string, int64, error) {
 	token, err := jwt.Parse(jwtString, func(token *jwt.Token) (interface{}, error) {
 		// validate that the alg is what we expect
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -72,6 +99,10 @@ func validateJwt(c Context, jwtString string) (string, int64, error) {
 		if !claimOK {
 			return "", 0, errors.New("Failed to parse exp from jwt")
 		}
+		tokenScope, _ := claims["scope"].(string)
+		if tokenScope != scope {
+			return "", 0, fmt.Errorf("jwt scope \"%s\" is not valid here", tokenScope)
+		}
 
 		return username, int64(exp), nil
 	} else {
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	LeaderboardAverage = "average"
+	LeaderboardTotal   = "total"
+
+	DefaultLeaderboardMinMatches = 1
+	DefaultLeaderboardLimit      = 50
+	MaxLeaderboardLimit          = 500
+)
+
+// How a Stats field is ranked. Counting stats (kills, clutch wins etc)
+// are summed up, rate stats (ADR, HLTV etc) are averaged over all of the
+// player's rounds so that short matches don't count as much as long ones
+type leaderboardMetric struct {
+	column    string
+	aggregate string
+}
+
+// Every field in Stats can be ranked. The metrics are named by their JSON
+// key so the frontend can use the same names it uses for the scoreboard
+var LeaderboardMetrics = getLeaderboardMetrics()
+
+func getLeaderboardMetrics() map[string]leaderboardMetric {
+	t := reflect.TypeOf(Stats{})
+	floatType := reflect.TypeOf(PlayerF64Map{})
+	metrics := make(map[string]leaderboardMetric)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		column := field.Tag.Get("db")
+		if column == "" {
+			continue
+		}
+
+		aggregate := LeaderboardTotal
+		if field.Type == floatType {
+			aggregate = LeaderboardAverage
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		metrics[name] = leaderboardMetric{column: column, aggregate: aggregate}
+	}
+
+	return metrics
+}
+
+func getLeaderboardMetricNames() []string {
+	names := make([]string, 0, len(LeaderboardMetrics))
+	for name := range LeaderboardMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The SQL expression for the metric's value. Both of the supported
+// databases are fine with the same expression apart from the float type
+func (m leaderboardMetric) valueExpr(floatType string) string {
+	if m.aggregate == LeaderboardTotal {
+		return "CAST(SUM(match_player_stats." + m.column + ") AS " + floatType + ")"
+	}
+
+	return "COALESCE(" +
+		"SUM(match_player_stats." + m.column + " * " + matchRoundsExpr + ") / " +
+		"CAST(NULLIF(SUM(" + matchRoundsExpr + "), 0) AS " + floatType + "), 0)"
+}
+
+// Fill in the ranks. Players with the same value share a rank
+func rankLeaderboard(entries []LeaderboardEntry) {
+	for i := range entries {
+		entries[i].Value = round2(entries[i].Value)
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+}
@@ -38,7 +38,7 @@ const (
 func main() {
 	args := os.Args[1:]
 	if len(args) == 0 {
-		fmt.Println("Commands: parse, serve, migrate, argon")
+		fmt.Println("Commands: parse, serve, migrate, recompute-dates, argon")
 		return
 	}
 
@@ -77,12 +77,14 @@ func main() {
 		commandServe(context)
 	case "migrate":
 		commandMigrate(args, context)
+	case "recompute-dates":
+		commandRecomputeDates(context)
 	}
 }
 
 func commandParse(args []string, config Config, logger *Logger) {
 	if len(args) >= 2 && args[1] != "" {
-		output, err := parseDemo(args[1], ".", config, logger)
+		output, err := parseDemo(args[1], config, nil, logger)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return
@@ -110,11 +112,16 @@ func commandServe(c Context) {
 
 	c.logger.Info("completed database migrations")
 
+	// Make sure the ratings are there for matches that were parsed before
+	// ratings were added
+	updateRatings("startup", c)
+
 	scheduler := gocron.NewScheduler(time.UTC)
 	registerJobs(scheduler, c)
 	c.logger.Info("starting job scheduler")
 	scheduler.StartAsync()
 
+	runJobWorkers(c)
 	go watchFileChanges(c)
 	c.logger.Infof("starting Puggies HTTP server on port %s", c.config.port)
 	runServer(c)
@@ -127,6 +134,75 @@ func commandMigrate(args []string, c Context) {
 	}
 }
 
+// Works out the dates of existing matches again without reparsing them,
+// for matches parsed before the file time and match info were used
+func commandRecomputeDates(c Context) {
+	err := c.db.RunMigration(c.config, "up")
+	if err != nil {
+		c.logger.Errorf("failed to run database migrations: %s", err.Error())
+		return
+	}
+
+	dates, err := c.db.GetMatchDates()
+	if err != nil {
+		c.logger.Error(err)
+		return
+	}
+
+	updated := 0
+	moved := false
+	for _, date := range dates {
+		if date.DemoPath == "" || date.DemoRoot >= len(c.config.demosPaths) {
+			c.logger.Warnf("demo=%s skipping, couldn't find demo file", date.Id)
+			continue
+		}
+
+		path := join(c.config.demosPaths[date.DemoRoot], date.DemoPath)
+		archive, _, _ := splitArchivePath(path)
+		if _, err := os.Stat(archive); err != nil {
+			c.logger.Warnf("demo=%s skipping, couldn't find demo file", date.Id)
+			continue
+		}
+
+		demoTime, source := getDemoTime(c.config, c.logger, path)
+
+		// The time the match was originally parsed at is as good as
+		// the time right now
+		timestamp := demoTime.UnixMilli()
+		if source == DateSourceParsed {
+			timestamp = date.DateTimestamp
+		}
+
+		if timestamp == date.DateTimestamp && source == date.DateSource {
+			continue
+		}
+
+		err = c.db.UpdateMatchDate(MatchDate{Id: date.Id, DateTimestamp: timestamp, DateSource: source})
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to update date: %s", date.Id, err.Error())
+			continue
+		}
+
+		c.logger.Infof(
+			"demo=%s date changed from %s to %s (%s)",
+			date.Id,
+			time.UnixMilli(date.DateTimestamp).Format(time.RFC3339),
+			time.UnixMilli(timestamp).Format(time.RFC3339),
+			source,
+		)
+		updated += 1
+		moved = moved || timestamp != date.DateTimestamp
+	}
+
+	c.logger.Infof("updated the dates of %d out of %d matches", updated, len(dates))
+
+	// Ratings are computed in match order so they have to be redone
+	// if any of the dates moved
+	if moved {
+		updateRatings("recompute-dates", c)
+	}
+}
+
 func commandArgon(args []string, logger *Logger) {
 	argon2ID := NewArgon2ID()
 	if len(args) < 2 {
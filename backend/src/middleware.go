@@ -30,11 +30,32 @@ func AuthRequired(c Context) gin.HandlerFunc {
 	return AllowedRoles(c, nil)
 }
 
+// Like AuthRequired, but an event stream token (see createEventsJwt) can be
+// given in the token query parameter instead. Browsers can't set headers on
+// EventSource connections so this is the only way for them to authenticate
+// the event stream
+func StreamAuthRequired(c Context) gin.HandlerFunc {
+	return authenticate(c, nil, true)
+}
+
 func AllowedRoles(c Context, allowedRoles []string) gin.HandlerFunc {
+	return authenticate(c, allowedRoles, false)
+}
+
+func authenticate(c Context, allowedRoles []string, allowQueryToken bool) gin.HandlerFunc {
 	return func(ginc *gin.Context) {
 		auth := ginc.GetHeader("Authorization")
 		authWords := strings.Fields(auth)
-		if len(authWords) != 2 || authWords[0] != "Bearer" {
+
+		var token, scope string
+		if len(authWords) == 2 && authWords[0] == "Bearer" {
+			token = authWords[1]
+		} else if allowQueryToken && auth == "" && ginc.Query("token") != "" {
+			// Session tokens aren't accepted in the URL since it ends up
+			// in logs and the browser history
+			token = ginc.Query("token")
+			scope = JwtScopeEvents
+		} else {
 			c.logger.Warnf("invalid Authorization header encountered: %s", auth)
 			ginc.AbortWithStatusJSON(
 				http.StatusUnauthorized,
@@ -43,8 +64,7 @@ func AllowedRoles(c Context, allowedRoles []string) gin.HandlerFunc {
 			return
 		}
 
-		token := authWords[1]
-		username, _, err := validateJwt(c, token)
+		username, _, err := validateScopedJwt(c, token, scope)
 		if err != nil {
 			c.logger.Warn("invalid JWT provided")
 			c.logger.Warn(err.Error())
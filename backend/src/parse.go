@@ -20,334 +20,246 @@
 package main
 
 import (
-	"os"
-
-	r2 "github.com/golang/geo/r2"
-
-	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
-	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
-	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
-	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+	"bufio"
+	"errors"
+	"io"
+	"time"
 )
 
 const (
-	ParserVersion = 2
-)
+	ParserVersion = 13
 
-func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return Match{}, err
-	}
+	// The first 8 bytes of a demo tell us which game recorded it
+	DemoFormatCsgo = "HL2DEMO"
+	DemoFormatCs2  = "PBDEMS2"
 
-	defer f.Close()
-
-	p := dem.NewParser(f)
-	defer p.Close()
+	// MR3 overtime, which is what both games use unless the server
+	// was configured otherwise
+	DefaultOvertimeLength = 6
+)
 
-	header, err := p.ParseHeader()
+// Reads the file stamp from the demo header without consuming any of it
+func getDemoFormat(r *bufio.Reader) (string, error) {
+	stamp, err := r.Peek(8)
 	if err != nil {
-		return Match{}, err
+		return "", err
 	}
 
-	mapMetadata := metadata.MapNameToMap[header.MapName]
-	id := getDemoFileName(path)
-	demoType := getDemoType(id)
-	demoTime := getDemoTime(config, logger, id)
-
-	prd := PerRoundData{}
-
-	var teams TeamsMap
-	var playerNames NamesMap
-
-	// Only tracked for one round for use in KAST and RWS
-	var bombPlanter uint64
-	var bombDefuser uint64
-	var bombPlanterTime int64 = 0
-	var bombDefuserTime int64 = 0
-	var roundStartTime int64 = 0
-	var bombExplodeTime int64 = 0
-
-	var ctClanTag string
-	var tClanTag string
-
-	consecutiveMatchStarts := 0
-	eseaMode := demoType == "esea"
-	valveMode := demoType == "steam"
-	isLive := !eseaMode && !valveMode
-
-	deathTimes := make(map[uint64]Death)
-	leavers := make(map[uint64]uint64)
-	heatmaps := make(map[string][]r2.Point)
-
-	p.RegisterEventHandler(func(e events.Kill) {
-		if len(prd.kills) == 0 {
-			return
-		}
-
-		if e.Victim != nil {
-			prd.deaths[len(prd.deaths)-1][unBotify(e.Victim.SteamID64)] += 1
+	// the stamp is null-terminated
+	for i, b := range stamp {
+		if b == 0 {
+			return string(stamp[:i]), nil
 		}
+	}
 
-		if e.Assister != nil && e.Victim != nil && e.Assister.Team != e.Victim.Team {
-			if e.AssistedFlash {
-				prd.flashAssists[len(prd.flashAssists)-1][unBotify(e.Assister.SteamID64)] += 1
-			} else {
-				prd.assists[len(prd.assists)-1][unBotify(e.Assister.SteamID64)] += 1
-			}
-		}
-
-		if e.Killer != nil && e.Victim != nil && e.Killer.Team != e.Victim.Team {
-			prd.kills[len(prd.kills)-1][unBotify(e.Killer.SteamID64)] += 1
-
-			if e.IsHeadshot {
-				prd.headshots[len(prd.headshots)-1][unBotify(e.Killer.SteamID64)] += 1
-			}
-
-			deathTimes[unBotify(e.Victim.SteamID64)] = Death{
-				KilledBy:    unBotify(e.Killer.SteamID64),
-				TimeOfDeath: p.CurrentTime().Seconds(),
-			}
-
-			if prd.headToHead[len(prd.headToHead)-1][unBotify(e.Killer.SteamID64)] == nil {
-				prd.headToHead[len(prd.headToHead)-1][unBotify(e.Killer.SteamID64)] = make(map[uint64]Kill)
-			}
-
-			var assister uint64 = 0
-			if e.Assister != nil {
-				assister = unBotify(e.Assister.SteamID64)
-			}
-
-			killInfo := Kill{
-				Weapon:            processWeaponName(*e.Weapon),
-				Assister:          assister,
-				Time:              p.CurrentTime().Milliseconds() - roundStartTime,
-				IsHeadshot:        e.IsHeadshot,
-				AttackerBlind:     e.AttackerBlind,
-				AssistedFlash:     e.AssistedFlash,
-				NoScope:           e.NoScope,
-				ThroughSmoke:      e.ThroughSmoke,
-				PenetratedObjects: e.PenetratedObjects,
-				AttackerLocation:  e.Killer.LastPlaceName(),
-				VictimLocation:    e.Victim.LastPlaceName(),
-			}
-
-			if prd.openings[len(prd.openings)-1] == nil {
-				prd.openings[len(prd.openings)-1] = &OpeningKill{
-					Kill:     killInfo,
-					Attacker: unBotify(e.Killer.SteamID64),
-					Victim:   unBotify(e.Victim.SteamID64),
-				}
-			}
+	return string(stamp), nil
+}
 
-			prd.headToHead[len(prd.headToHead)-1][unBotify(e.Killer.SteamID64)][unBotify(e.Victim.SteamID64)] = killInfo
+// Calls onProgress with the percentage of the file that has been read
+// each time it goes up by at least one
+type progressReader struct {
+	r          io.Reader
+	read       int64
+	total      int64
+	last       int
+	onProgress func(int)
+}
 
-			// check for trade kills
-			for deadPlayer := range prd.deaths[len(prd.deaths)-1] {
-				if deathTimes[deadPlayer].KilledBy == unBotify(e.Victim.SteamID64) {
-					// Using 5 seconds as the trade window for now
-					if p.CurrentTime().Seconds()-deathTimes[deadPlayer].TimeOfDeath <= 5 {
-						prd.deathsTraded[len(prd.deathsTraded)-1][deadPlayer] += 1
-						prd.tradeKills[len(prd.tradeKills)-1][unBotify(e.Killer.SteamID64)] += 1
-					}
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
 
-				}
-			}
-		}
-	})
-
-	p.RegisterEventHandler(func(e events.PlayerFlashed) {
-		if len(prd.kills) == 0 {
-			return
+	if p.total > 0 {
+		percent := int(p.read * 100 / p.total)
+		if percent > p.last {
+			p.last = percent
+			p.onProgress(percent)
 		}
+	}
 
-		blindMs := e.FlashDuration().Milliseconds()
+	return n, err
+}
 
-		// https://counterstrike.fandom.com/wiki/Flashbang
-		if blindMs > 1950 {
-			if e.Attacker.Team == e.Player.Team {
-				prd.teammatesFlashed[len(prd.teammatesFlashed)-1][unBotify(e.Attacker.SteamID64)] += 1
-			} else {
-				prd.enemiesFlashed[len(prd.enemiesFlashed)-1][unBotify(e.Attacker.SteamID64)] += 1
-			}
+// onProgress is optional. If it's provided it's called with the
+// percentage of the demo that has been parsed so far. The demo can be
+// compressed or inside an archive, see openDemo
+func parseDemo(path string, config Config, onProgress func(int), logger *Logger) (Match, error) {
+	id := getDemoId(config.demosPaths, path)
+	demoTypes := newDemoTypeDetector(id)
+	demoTime, dateSource := getDemoTime(config, logger, path)
+
+	// Keep track of how far through the first pass we got so progress
+	// doesn't go backwards if we have to parse the demo again
+	parsed := 0
+	progress := onProgress
+	if onProgress != nil {
+		progress = func(percent int) {
+			parsed = percent
+			onProgress(percent)
 		}
-	})
-
-	p.RegisterEventHandler(func(e events.BombDefused) {
-		bombDefuser = unBotify(e.Player.SteamID64)
-		bombDefuserTime = p.CurrentTime().Milliseconds() - roundStartTime
-	})
-
-	p.RegisterEventHandler(func(e events.BombPlanted) {
-		bombPlanter = unBotify(e.Player.SteamID64)
-		bombPlanterTime = p.CurrentTime().Milliseconds() - roundStartTime
-	})
-
-	p.RegisterEventHandler(func(e events.BombExplode) {
-		bombExplodeTime = p.CurrentTime().Milliseconds() - roundStartTime
-	})
+	}
 
-	p.RegisterEventHandler(func(e events.WeaponFire) {
-		if e.Shooter == nil || prd.flashesThrown == nil {
-			return
-		}
+	state, err := parseDemoFile(path, id, demoTypes, true, config, progress, logger)
+	if err != nil {
+		return Match{}, err
+	}
 
-		if e.Weapon.Type == common.EqFlash {
-			prd.flashesThrown[len(prd.flashesThrown)-1][unBotify(e.Shooter.SteamID64)] += 1
+	// The server name, ConVars and plugin messages can change our mind about
+	// the demo type after the warmup and knife rounds have been decided. If
+	// that happens the first pass stops there and we go through the demo
+	// again with the right type, reporting progress over what's left
+	if state.demoModeChanged() {
+		logger.Infof("demo=%s detected as %s after parsing, parsing again", id, demoTypes.demoType())
+
+		if onProgress != nil {
+			start := parsed
+			progress = func(percent int) {
+				onProgress(start + (100-start)*percent/100)
+			}
 		}
 
-		if e.Weapon.Type == common.EqHE {
-			prd.HEsThrown[len(prd.HEsThrown)-1][unBotify(e.Shooter.SteamID64)] += 1
+		state, err = parseDemoFile(path, id, demoTypes, false, config, progress, logger)
+		if err != nil {
+			return Match{}, err
 		}
+	}
 
-		if e.Weapon.Type == common.EqMolotov || e.Weapon.Type == common.EqIncendiary {
-			prd.molliesThrown[len(prd.molliesThrown)-1][unBotify(e.Shooter.SteamID64)] += 1
-		}
+	match := computeMatch(state, id, demoTime, dateSource, logger)
+	match.Meta.DemoRoot, match.Meta.DemoPath, _ = locateDemo(config.demosPaths, path)
+	return match, nil
+}
 
-		if e.Weapon.Type == common.EqSmoke {
-			prd.smokesThrown[len(prd.smokesThrown)-1][unBotify(e.Shooter.SteamID64)] += 1
-		}
+func parseDemoFile(
+	path string,
+	id string,
+	demoTypes *demoTypeDetector,
+	cancelOnModeChange bool,
+	config Config,
+	onProgress func(int),
+	logger *Logger,
+) (*parseState, error) {
+	f, err := openDemo(path, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-		x, y := mapMetadata.TranslateScale(e.Shooter.Position().X, e.Shooter.Position().Y)
-		heatmaps["shotsFired"] = append(heatmaps["shotsFired"], r2.Point{X: x, Y: y})
-	})
+	demo := bufio.NewReader(f)
+	format, err := getDemoFormat(demo)
+	if err != nil {
+		return nil, err
+	}
 
-	p.RegisterEventHandler(func(e events.PlayerHurt) {
-		if len(prd.damage) == 0 {
-			return
-		}
+	logger.Infof("demo=%s format=%s parsing demo", id, format)
 
-		if e.Attacker != nil && e.Player != nil && e.Attacker.Team != e.Player.Team {
-			prd.damage[len(prd.damage)-1][unBotify(e.Attacker.SteamID64)] += e.HealthDamageTaken
+	switch format {
+	case DemoFormatCsgo:
+		return parseCsgoDemo(demo, demoTypes, cancelOnModeChange, config, logger)
+	case DemoFormatCs2:
+		return parseCs2Demo(demo, demoTypes, cancelOnModeChange, config, logger)
+	default:
+		return nil, errors.New("unrecognized demo format \"" + format + "\"")
+	}
+}
 
-			// logger.Debugf("%s <%s> -> %s (%d HP)\n", e.Attacker.Name, e.Weapon, e.Player.Name, e.HealthDamageTaken)
+// Picks the half length from mp_maxrounds if the demo had it. Otherwise
+// we have to guess based on the score
+func getHalfLength(rounds []Round, maxRounds int) int {
+	if maxRounds > 0 {
+		return maxRounds / 2
+	}
 
-			if e.Weapon.Type == common.EqHE ||
-				e.Weapon.Type == common.EqMolotov ||
-				e.Weapon.Type == common.EqIncendiary {
-				prd.utilDamage[len(prd.utilDamage)-1][unBotify(e.Attacker.SteamID64)] += e.HealthDamageTaken
-			}
+	// MR15, MR12 (matchmaking since late 2022) and short matches. The
+	// scores only add up for the right one since the teams get credited
+	// for the wrong side's rounds otherwise
+	for _, halfLength := range []int{15, 12, 8} {
+		if halfLengthValid(rounds, halfLength) {
+			return halfLength
 		}
-	})
+	}
 
-	p.RegisterEventHandler(func(e events.MatchStart) {
-		if prd.isLive == nil {
-			return
-		}
+	// Matches that didn't finish
+	if len(rounds) <= 16 {
+		return 8
+	}
+	return 15
+}
 
-		logger.DebugBig("MATCH START EVENT")
+// Whether the match could have been played with the given half length.
+// Either someone won in regulation or it was tied going into overtime
+func halfLengthValid(rounds []Round, halfLength int) bool {
+	regulation := halfLength * 2
+	teamAScore, _ := getScore(rounds, "CT", regulation, halfLength, DefaultOvertimeLength)
+	teamBScore, _ := getScore(rounds, "T", regulation, halfLength, DefaultOvertimeLength)
 
-		if valveMode {
-			// The MatchStart event comes after the RoundStart event so we need to
-			// set the current round's live status in addition to updating the isLive variable.
-			// Same thing goes for the ESEA demo code below
-			prd.isLive[len(prd.isLive)-1] = true
-			isLive = true
-		}
+	tied := teamAScore == halfLength && teamBScore == halfLength
+	if len(rounds) > regulation {
+		return tied
+	}
+	return tied || max(teamAScore, teamBScore) == halfLength+1
+}
 
-		if eseaMode {
-			if consecutiveMatchStarts < 3 {
-				prd.isLive[len(prd.isLive)-1] = false
-				isLive = false
-				logger.DebugBig("NOT LIVE")
-				consecutiveMatchStarts += 1
-			} else {
-				prd.isLive[len(prd.isLive)-1] = true
-				isLive = true
-				logger.DebugBig("GOING LIVE")
-				consecutiveMatchStarts = 0
-			}
-		}
-	})
-
-	// Create a new 'round' map in each of the stats arrays
-	p.RegisterEventHandler(func(e events.RoundStart) {
-		logger.DebugBig("ROUND START")
-		logger.Debugf("CT %d - %d T", p.GameState().TeamCounterTerrorists().Score(), p.GameState().TeamTerrorists().Score())
-		prd.NewRound(isLive)
-
-		bombDefuser = 0
-		bombPlanter = 0
-		roundStartTime = p.CurrentTime().Milliseconds()
-		bombExplodeTime = 0
-		bombPlanterTime = 0
-		bombDefuserTime = 0
-
-		if teams == nil {
-			teams = make(TeamsMap)
-		}
+// Picks the overtime length from mp_overtime_maxrounds if the demo had it.
+// Otherwise we try the configured length and then the usual MR3 and MR6
+// formats, taking the first one that the overtime scores make sense for
+func getOvertimeLength(rounds []Round, halfLength, overtimeMaxRounds, defaultLength int) int {
+	if overtimeMaxRounds >= 2 && overtimeMaxRounds%2 == 0 {
+		return overtimeMaxRounds
+	}
 
-		if playerNames == nil {
-			playerNames = make(NamesMap)
-		}
+	if len(rounds) <= halfLength*2 {
+		return defaultLength
+	}
 
-		updatePlayerNames(&p, &playerNames)
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
-	})
-
-	// Update the teams when the side switches
-	p.RegisterEventHandler(func(e events.TeamSideSwitch) {
-		logger.DebugBig("SIDE SWITCH")
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
-	})
-
-	p.RegisterEventHandler(func(e events.PlayerDisconnected) {
-		if !e.Player.IsBot && isLive {
-			leaverTeam := teams[e.Player.SteamID64]
-			var teammate uint64
-			for p, team := range teams {
-				if team == leaverTeam && p != e.Player.SteamID64 {
-					teammate = p
-				}
-			}
-			leavers[e.Player.SteamID64] = teammate
+	for _, length := range []int{defaultLength, 6, 12} {
+		if overtimeScoresValid(computeHalves(rounds, halfLength, length), length) {
+			return length
 		}
-	})
-
-	p.RegisterEventHandler(func(e events.RoundEnd) {
-		logger.Debug(e)
-		winner := ""
+	}
 
-		switch e.Winner {
-		case common.TeamCounterTerrorists:
-			winner = "CT"
-		case common.TeamTerrorists:
-			winner = "T"
-		}
+	return defaultLength
+}
 
-		if len(prd.rounds) == 0 {
-			return
+// Every overtime period except the last one has to end in a draw since
+// otherwise there wouldn't have been another one. The last one has to
+// have been won by one team without them going past the win condition
+func overtimeScoresValid(halves []Half, overtimeLength int) bool {
+	teamAScores := make(map[int]int)
+	teamBScores := make(map[int]int)
+	last := 0
+	for _, half := range halves {
+		if half.Overtime == 0 {
+			continue
 		}
+		teamAScores[half.Overtime] += half.TeamAScore
+		teamBScores[half.Overtime] += half.TeamBScore
+		last = max(last, half.Overtime)
+	}
 
-		updateTeams(&p, &teams, &ctClanTag, &tClanTag, leavers)
-
-		prd.rounds[len(prd.rounds)-1] = Round{
-			Winner:          winner,
-			Reason:          int(e.Reason),
-			Planter:         bombPlanter,
-			Defuser:         bombDefuser,
-			PlanterTime:     bombPlanterTime,
-			DefuserTime:     bombDefuserTime,
-			BombExplodeTime: bombExplodeTime,
+	toWin := overtimeLength/2 + 1
+	for overtime := 1; overtime <= last; overtime++ {
+		a, b := teamAScores[overtime], teamBScores[overtime]
+		if overtime < last && a != b {
+			return false
 		}
-
-		var roundWinners []uint64
-		for player := range teams {
-			if teams[player] == winner {
-				roundWinners = append(roundWinners, player)
-			}
+		if overtime == last && max(a, b) != toWin {
+			return false
 		}
+	}
 
-		prd.winners[len(prd.winners)-1] = roundWinners
-	})
+	return true
+}
 
-	logger.Infof("demo=%s parsing demo", id)
-	err = p.ParseToEnd()
-	if err != nil {
-		return Match{}, err
-	}
+// Computes all of the match stats from the data collected by the parser
+func computeMatch(state *parseState, id string, demoTime time.Time, dateSource string, logger *Logger) Match {
+	prd := &state.prd
+	teams := state.teams
+	playerNames := state.playerNames
+	eseaMode := state.eseaMode
+	valveMode := state.valveMode
 
-	logger.Infof("demo=%s computing stats", id)
+	demoType, demoTypeConfidence := state.demoTypes.result()
+	logger.Infof("demo=%s type=%s confidence=%.2f computing stats", id, demoType, demoTypeConfidence)
 
 	if eseaMode {
 		stripPlayerPrefixes(teams, &playerNames, "CT")
@@ -370,6 +282,11 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 	impact := computeImpact(totalRounds, teams, totals.assists, kpr)
 	k2, k3, k4, k5 := computeMultikills(prd.kills)
 	oKills, oDeaths, oAttempts, oAttemptsPct, oSuccess := computeOpenings(totals.openingKills)
+	clutchAttempts, clutchWins, clutchAttemptsByX, clutchWinsByX := computeClutches(prd.clutches)
+	failedTrades, timeToTrade := computeTrades(prd.trades)
+	weapons := computeWeaponStats(prd.weapons)
+	shotsFired, shotsHit, accuracy, firstShotsFired, firstShotsHit, firstShotAccuracy := computeAccuracy(weapons)
+	headHits, chestHits, stomachHits, armHits, legHits := computeHitGroups(weapons)
 
 	hltv := computeHLTV(
 		totalRounds,
@@ -381,27 +298,32 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 		adr,
 	)
 
-	halfLength := 15
-	teamAScore, _ := getScore(prd.rounds, "CT", 999999999, halfLength)
-	teamBScore, _ := getScore(prd.rounds, "T", 999999999, halfLength)
-
-	teamAScore16round, _ := getScore(prd.rounds, "CT", 999999999, 8)
-	teamBScore16round, _ := getScore(prd.rounds, "T", 999999999, 8)
-
-	// If the sum of scores is 16 or less and neither team got 16-0'd
-	// then it must be a short match
-	if teamAScore+teamBScore <= 16 && teamAScore != 16 && teamBScore != 16 {
-		teamAScore = teamAScore16round
-		teamBScore = teamBScore16round
-		halfLength = 8
-	}
+	halfLength := getHalfLength(prd.rounds, state.maxRounds)
+	overtimeLength := getOvertimeLength(prd.rounds, halfLength, state.overtimeMaxRounds, state.defaultOvertimeLength)
+	teamAScore, _ := getScore(prd.rounds, "CT", 999999999, halfLength, overtimeLength)
+	teamBScore, _ := getScore(prd.rounds, "T", 999999999, halfLength, overtimeLength)
+
+	computeBuyTypes(prd.rounds, halfLength)
+	roundByRound := computeRoundByRound(
+		prd.rounds,
+		prd.headToHead,
+		prd.clutches,
+		prd.trades,
+		prd.startMoney,
+		prd.equipmentValue,
+		prd.moneySpent,
+		halfLength,
+		overtimeLength,
+	)
 
 	matchData := MatchData{
-		TotalRounds: totalRounds,
-		Teams:       teams,
-		StartTeams:  computeStartSides(teams, prd.rounds, halfLength),
-		Rounds:      prd.rounds,
-		HalfLength:  halfLength,
+		TotalRounds:    totalRounds,
+		Teams:          teams,
+		StartTeams:     computeStartSides(teams, prd.rounds, halfLength, overtimeLength),
+		Rounds:         prd.rounds,
+		HalfLength:     halfLength,
+		OvertimeLength: overtimeLength,
+		Halves:         computeHalves(prd.rounds, halfLength, overtimeLength),
 
 		Stats: Stats{
 			Adr:                adr,
@@ -431,36 +353,69 @@ func parseDemo(path, heatmapsDir string, config Config, logger *Logger) (Match,
 			TeammatesFlashed:   totals.teammatesFlashed,
 			DeathsTraded:       totals.deathsTraded,
 			TradeKills:         totals.tradeKills,
+			FailedTrades:       failedTrades,
+			TimeToTrade:        timeToTrade,
 			UtilDamage:         totals.utilDamage,
 
+			ClutchAttempts:    clutchAttempts,
+			ClutchWins:        clutchWins,
+			Clutch1v1Attempts: clutchAttemptsByX[0],
+			Clutch1v1Wins:     clutchWinsByX[0],
+			Clutch1v2Attempts: clutchAttemptsByX[1],
+			Clutch1v2Wins:     clutchWinsByX[1],
+			Clutch1v3Attempts: clutchAttemptsByX[2],
+			Clutch1v3Wins:     clutchWinsByX[2],
+			Clutch1v4Attempts: clutchAttemptsByX[3],
+			Clutch1v4Wins:     clutchWinsByX[3],
+			Clutch1v5Attempts: clutchAttemptsByX[4],
+			Clutch1v5Wins:     clutchWinsByX[4],
+
 			K2: k2,
 			K3: k3,
 			K4: k4,
 			K5: k5,
+
+			ShotsFired:        shotsFired,
+			ShotsHit:          shotsHit,
+			Accuracy:          accuracy,
+			FirstShotsFired:   firstShotsFired,
+			FirstShotsHit:     firstShotsHit,
+			FirstShotAccuracy: firstShotAccuracy,
+			HeadHits:          headHits,
+			ChestHits:         chestHits,
+			StomachHits:       stomachHits,
+			ArmHits:           armHits,
+			LegHits:           legHits,
+
+			Weapons: weapons,
 		},
 
 		HeadToHead:   headToHeadTotal(&prd.headToHead),
 		KillFeed:     prd.headToHead,
-		RoundByRound: computeRoundByRound(prd.rounds, prd.headToHead, halfLength),
+		RoundByRound: roundByRound,
 		OpeningKills: totals.openingKills,
 	}
 
 	output := Match{
 		Meta: MetaData{
-			Map:           header.MapName,
-			Id:            id,
-			DateTimestamp: demoTime.UnixMilli(),
-			DemoType:      demoType,
-			PlayerNames:   playerNames,
-			TeamAScore:    teamAScore,
-			TeamBScore:    teamBScore,
-			TeamATitle:    getTeamName(ctClanTag, teams, playerNames, hltv, "CT"),
-			TeamBTitle:    getTeamName(tClanTag, teams, playerNames, hltv, "T"),
+			Map:                state.mapName,
+			Id:                 id,
+			DateTimestamp:      demoTime.UnixMilli(),
+			DateSource:         dateSource,
+			DemoType:           demoType,
+			DemoTypeConfidence: demoTypeConfidence,
+			PlayerNames:        playerNames,
+			TeamAScore:         teamAScore,
+			TeamBScore:         teamBScore,
+			TeamATitle:         getTeamName(state.ctClanTag, teams, playerNames, hltv, "CT"),
+			TeamBTitle:         getTeamName(state.tClanTag, teams, playerNames, hltv, "T"),
 		},
 		MatchData: matchData,
-		HeatMaps:  heatmaps,
+		Positions: computePositions(prd.positions),
+		Replays:   prd.frames,
+		Utility:   computeUtility(prd.grenades),
 	}
 
 	logger.Infof("demo=%s completed parsing", id)
-	return output, nil
+	return output
 }
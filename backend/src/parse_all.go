@@ -22,70 +22,243 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 )
 
-func parseIdempotent(path, heatmapsDir string, shouldRestore bool, c Context) error {
-	demoId := getDemoFileName(path)
+// What should happen to a demo when it's parsed, and how to describe it
+// in the audit log
+type parseAction struct {
+	action string
+	format string
+}
+
+// Work out whether the demo needs to be parsed. Returns nil if the match
+// is up to date or was deleted (unless we are restoring it)
+func getParseAction(demoId string, shouldRestore bool, c Context) (*parseAction, error) {
 	alreadyParsed, version, err := c.db.HasMatch(demoId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	format := "New match added from demo %s with parser version %d"
-	action := "MATCH_ADDED"
-
 	deleted := alreadyParsed && version == 0
 	upToDate := alreadyParsed && version == ParserVersion
 	outOfDate := alreadyParsed && version != ParserVersion && !deleted
 
 	if upToDate || (deleted && !shouldRestore) {
-		return nil
+		return nil, nil
 	} else if outOfDate {
-		format = "Demo %s updated to new parser version %d"
-		action = "MATCH_UPDATED"
+		return &parseAction{
+			action: "MATCH_UPDATED",
+			format: "Demo %s updated to new parser version %d",
+		}, nil
 	} else if deleted && shouldRestore {
-		format = "Demo %s restored with parser version %d"
-		action = "MATCH_RESTORED"
+		return &parseAction{
+			action: "MATCH_RESTORED",
+			format: "Demo %s restored with parser version %d",
+		}, nil
+	}
+
+	return &parseAction{
+		action: "MATCH_ADDED",
+		format: "New match added from demo %s with parser version %d",
+	}, nil
+}
+
+// Different demo files can still end up with the same match ID, like a
+// demo parsed with the parse command and one in the first demo folder with
+// the same name. Returns the full path of the demo the match was parsed
+// from if it's a different file that's still there
+func findDemoIdConflict(demoId, path string, c Context) (string, error) {
+	root, demoPath, err := c.db.GetDemoPath(demoId)
+	if err != nil || demoPath == "" || root >= len(c.config.demosPaths) {
+		return "", err
+	}
+
+	newRoot, newPath, _ := locateDemo(c.config.demosPaths, path)
+	if root == newRoot && demoPath == newPath {
+		return "", nil
 	}
 
-	output, err := parseDemo(path, heatmapsDir, c.config, c.logger)
+	// The demo was moved while we weren't watching the folder
+	existing := join(c.config.demosPaths[root], demoPath)
+	if _, err := demoModTime(existing); err != nil {
+		return "", nil
+	}
+
+	return existing, nil
+}
+
+func parseIdempotent(path, heatmapsDir string, shouldRestore bool, c Context) error {
+	demoId := getDemoId(c.config.demosPaths, path)
+	conflict, err := findDemoIdConflict(demoId, path, c)
 	if err != nil {
 		return err
-	} else {
-		err := c.db.UpsertMatches(output)
-		if err != nil {
-			return err
-		}
+	}
 
-		c.db.InsertAuditEntry(AuditEntry{
-			System:      true,
-			Action:      action,
-			Description: fmt.Sprintf(format, demoId, ParserVersion),
-		})
+	if conflict != "" {
+		return fmt.Errorf("match %s was already parsed from %s", demoId, conflict)
 	}
 
+	action, err := getParseAction(demoId, shouldRestore, c)
+	if err != nil {
+		return err
+	}
+
+	if action == nil {
+		return nil
+	}
+
+	c.events.Publish(ServerEvent{Type: EventParseStarted, DemoId: demoId})
+
+	err = parseAndStore(path, heatmapsDir, c)
+	if err != nil {
+		c.events.Publish(ServerEvent{Type: EventParseFailed, DemoId: demoId, Error: err.Error()})
+		return err
+	}
+
+	c.db.InsertAuditEntry(AuditEntry{
+		System:      true,
+		Action:      action.action,
+		Description: fmt.Sprintf(action.format, demoId, ParserVersion),
+	})
+
+	c.events.Publish(ServerEvent{Type: EventParseCompleted, DemoId: demoId})
 	return nil
 }
 
-func parseAllIdempotent(inDir, outDir string, c Context) error {
-	files, err := filepath.Glob(inDir + "/*.dem")
+func parseAndStore(path, heatmapsDir string, c Context) error {
+	demoId := getDemoId(c.config.demosPaths, path)
+	onProgress := func(progress int) {
+		c.events.Publish(ServerEvent{
+			Type:     EventParseProgress,
+			DemoId:   demoId,
+			Progress: progress,
+		})
+	}
+
+	output, err := parseDemo(path, c.config, onProgress, c.logger)
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(join(outDir, "/heatmaps"), os.ModePerm)
+	err = c.db.UpsertMatches(output)
 	if err != nil {
 		return err
 	}
 
-	heatmapsDir := join(outDir, "heatmaps")
+	err = c.db.UpsertReplays(output.Meta.Id, output.Replays)
+	if err != nil {
+		return err
+	}
 
-	for _, file := range files {
-		err = parseIdempotent(file, heatmapsDir, false, c)
+	err = c.db.UpsertUtility(output.Meta.Id, output.Utility)
+	if err != nil {
+		return err
+	}
+
+	return genHeatmaps(output, heatmapsDir, join(c.config.assetsPath, "minimaps"), c.logger)
+}
+
+// The full path of the demo the match was parsed from. Matches that
+// aren't in the database are assumed to be uncompressed demos in the
+// first demo folder
+func getMatchDemoPath(id string, c Context) (string, error) {
+	root, demoPath, err := c.db.GetDemoPath(id)
+	if err != nil {
+		return "", err
+	}
+
+	if demoPath == "" {
+		demoPath = id + DemoExt
+	}
+
+	if root >= len(c.config.demosPaths) {
+		return "", fmt.Errorf("demo folder %d is no longer configured", root)
+	}
+
+	return join(c.config.demosPaths[root], demoPath), nil
+}
+
+// Queue every demo in the demo folders and their subfolders that needs to
+// be parsed. A demo that can't be queued is logged and skipped so that it
+// doesn't hold up the rest of the folder
+func queueAllDemos(inDirs []string, outDir string, c Context) error {
+	err := os.MkdirAll(join(outDir, "/heatmaps"), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, inDir := range inDirs {
+		sources, err := findDemoSources(inDir)
 		if err != nil {
 			return err
 		}
+		files = append(files, sources...)
+	}
+
+	var demos []string
+	for _, file := range files {
+		// Each demo in an archive is its own match
+		contents, err := listDemos(file)
+		if err != nil {
+			c.logger.Errorf("failed to read demo archive %s: %s", file, err.Error())
+			continue
+		}
+
+		demos = append(demos, contents...)
+	}
+
+	// Which demo each match ID belongs to in this scan
+	demoIds := make(map[string]string, len(demos))
+
+	for _, file := range demos {
+		demoId := getDemoId(c.config.demosPaths, file)
+		conflict, err := findDemoIdConflict(demoId, file, c)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to check demo path: %s", demoId, err.Error())
+			continue
+		}
+
+		if conflict != "" {
+			c.logger.Errorf("demo=%s skipping %s, the match was already parsed from %s", demoId, file, conflict)
+			continue
+		}
+
+		if other, ok := demoIds[demoId]; ok {
+			c.logger.Errorf("demo=%s skipping %s, it has the same match ID as %s", demoId, file, other)
+			continue
+		}
+		demoIds[demoId] = file
+
+		action, err := getParseAction(demoId, false, c)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to check match status: %s", demoId, err.Error())
+			continue
+		}
+
+		if action == nil {
+			continue
+		}
+
+		// Demos that have already failed every attempt aren't retried
+		// until the failed job is cleaned up or the file changes
+		latest, err := c.db.GetLatestJob(file)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to fetch parse job: %s", demoId, err.Error())
+			continue
+		}
+
+		if latest != nil && latest.Status == JobFailed {
+			c.logger.Debugf("demo=%s skipping demo with failed parse job %s", demoId, latest.Id)
+			continue
+		}
+
+		job, err := c.jobs.Enqueue(file, "")
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to queue demo for parsing: %s", demoId, err.Error())
+		} else {
+			c.logger.Infof("job=%s demo=%s queued demo for parsing", job.Id, job.DemoId)
+		}
 	}
 
 	return nil
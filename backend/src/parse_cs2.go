@@ -0,0 +1,342 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	r2 "github.com/golang/geo/r2"
+
+	// demoinfocs v2 only understands Source 1 demos so CS2 demos are parsed
+	// with v4. The CS:GO parser is left on v2 since it's known to work well
+	// with all of the demo types we support
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/events"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msgs2"
+
+	csgocommon "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+const (
+	// CS2 uses MR12 by default. Only used if the demo doesn't tell us
+	// what mp_maxrounds was set to
+	Cs2DefaultMaxRounds = 24
+)
+
+type cs2GameState struct {
+	p dem.Parser
+}
+
+func (s cs2GameState) currentTime() time.Duration {
+	return s.p.CurrentTime()
+}
+
+func (s cs2GameState) participants() []playerInfo {
+	return cs2PlayerInfos(s.p.GameState().Participants().All())
+}
+
+func (s cs2GameState) playing() []playerInfo {
+	return cs2PlayerInfos(s.p.GameState().Participants().Playing())
+}
+
+func (s cs2GameState) clanNames() (string, string) {
+	return s.p.GameState().TeamCounterTerrorists().ClanName(),
+		s.p.GameState().TeamTerrorists().ClanName()
+}
+
+func (s cs2GameState) teamScores() (int, int) {
+	return s.p.GameState().TeamCounterTerrorists().Score(),
+		s.p.GameState().TeamTerrorists().Score()
+}
+
+func cs2Team(team common.Team) string {
+	switch team {
+	case common.TeamCounterTerrorists:
+		return "CT"
+	case common.TeamTerrorists:
+		return "T"
+	}
+	return ""
+}
+
+func cs2PlayerInfo(player *common.Player) *playerInfo {
+	if player == nil {
+		return nil
+	}
+
+	position := player.Position()
+	return &playerInfo{
+		id:             unBotify(player.SteamID64),
+		userId:         player.UserID,
+		name:           player.Name,
+		isBot:          player.IsBot,
+		isConnected:    player.IsConnected,
+		isAlive:        player.IsAlive(),
+		team:           cs2Team(player.Team),
+		place:          player.LastPlaceName(),
+		x:              position.X,
+		y:              position.Y,
+		yaw:            player.ViewDirectionX(),
+		health:         player.Health(),
+		weapon:         cs2EquipmentType(player.ActiveWeapon()),
+		money:          player.Money(),
+		moneySpent:     player.MoneySpentThisRound(),
+		equipmentValue: player.EquipmentValueCurrent(),
+	}
+}
+
+func cs2PlayerInfos(players []*common.Player) []playerInfo {
+	ret := make([]playerInfo, 0, len(players))
+	for _, player := range players {
+		ret = append(ret, *cs2PlayerInfo(player))
+	}
+	return ret
+}
+
+// The equipment type values are the same between v2 and v4 so we can
+// convert them directly and reuse all the CS:GO weapon code
+func cs2EquipmentType(weapon *common.Equipment) csgocommon.EquipmentType {
+	if weapon == nil {
+		return csgocommon.EqUnknown
+	}
+	return csgocommon.EquipmentType(weapon.Type)
+}
+
+func (s cs2GameState) handleConVarsUpdated(handler func(map[string]string)) {
+	s.p.RegisterEventHandler(func(e events.ConVarsUpdated) {
+		handler(e.UpdatedConVars)
+	})
+}
+
+func (s cs2GameState) handleSayText(handler func(string)) {
+	s.p.RegisterEventHandler(func(e events.SayText) {
+		handler(e.Text)
+	})
+}
+
+func (s cs2GameState) handleSayText2(handler func(string, []string)) {
+	s.p.RegisterEventHandler(func(e events.SayText2) {
+		handler(e.MsgName, e.Params)
+	})
+}
+
+func (s cs2GameState) handleKill(handler func(*playerInfo, *playerInfo, *playerInfo, csgocommon.EquipmentType, Kill)) {
+	s.p.RegisterEventHandler(func(e events.Kill) {
+		weapon := ""
+		if e.Weapon != nil {
+			weapon = getWeaponFileName(cs2EquipmentType(e.Weapon))
+		}
+
+		handler(
+			cs2PlayerInfo(e.Killer),
+			cs2PlayerInfo(e.Victim),
+			cs2PlayerInfo(e.Assister),
+			cs2EquipmentType(e.Weapon),
+			Kill{
+				Weapon:            weapon,
+				IsHeadshot:        e.IsHeadshot,
+				AttackerBlind:     e.AttackerBlind,
+				AssistedFlash:     e.AssistedFlash,
+				NoScope:           e.NoScope,
+				ThroughSmoke:      e.ThroughSmoke,
+				PenetratedObjects: e.PenetratedObjects,
+			},
+		)
+	})
+}
+
+func (s cs2GameState) handlePlayerFlashed(handler func(*playerInfo, *playerInfo, time.Duration, int64)) {
+	s.p.RegisterEventHandler(func(e events.PlayerFlashed) {
+		var grenadeId int64
+		if e.Projectile != nil {
+			grenadeId = e.Projectile.UniqueID()
+		}
+
+		handler(cs2PlayerInfo(e.Attacker), cs2PlayerInfo(e.Player), e.FlashDuration(), grenadeId)
+	})
+}
+
+func (s cs2GameState) handleBombDefused(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.BombDefused) {
+		handler(cs2PlayerInfo(e.Player))
+	})
+}
+
+func (s cs2GameState) handleBombPlanted(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.BombPlanted) {
+		handler(cs2PlayerInfo(e.Player))
+	})
+}
+
+func (s cs2GameState) handleBombExplode(handler func()) {
+	s.p.RegisterEventHandler(func(e events.BombExplode) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handleWeaponFire(handler func(*playerInfo, csgocommon.EquipmentType)) {
+	s.p.RegisterEventHandler(func(e events.WeaponFire) {
+		handler(cs2PlayerInfo(e.Shooter), cs2EquipmentType(e.Weapon))
+	})
+}
+
+func (s cs2GameState) handleGrenadeThrow(handler func(int64, int, *playerInfo, csgocommon.EquipmentType)) {
+	s.p.RegisterEventHandler(func(e events.GrenadeProjectileThrow) {
+		handler(
+			e.Projectile.UniqueID(),
+			e.Projectile.Entity.ID(),
+			cs2PlayerInfo(e.Projectile.Thrower),
+			cs2EquipmentType(e.Projectile.WeaponInstance),
+		)
+	})
+}
+
+func (s cs2GameState) handleGrenadeDestroy(handler func(int64, int, float64, float64, []r2.Point)) {
+	s.p.RegisterEventHandler(func(e events.GrenadeProjectileDestroy) {
+		trajectory := make([]r2.Point, 0, len(e.Projectile.Trajectory2))
+		for _, point := range e.Projectile.Trajectory2 {
+			trajectory = append(trajectory, r2.Point{X: point.Position.X, Y: point.Position.Y})
+		}
+
+		position := e.Projectile.Position()
+		handler(e.Projectile.UniqueID(), e.Projectile.Entity.ID(), position.X, position.Y, trajectory)
+	})
+}
+
+func (s cs2GameState) handleGrenadeDetonate(handler func(int, *playerInfo, float64, float64)) {
+	onGrenade := func(e events.GrenadeEvent) {
+		handler(e.GrenadeEntityID, cs2PlayerInfo(e.Thrower), e.Position.X, e.Position.Y)
+	}
+
+	s.p.RegisterEventHandler(func(e events.HeExplode) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.FlashExplode) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.SmokeStart) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.FireGrenadeStart) {
+		onGrenade(e.GrenadeEvent)
+	})
+}
+
+func (s cs2GameState) handlePlayerHurt(handler func(*playerInfo, *playerInfo, int, csgocommon.EquipmentType, int)) {
+	s.p.RegisterEventHandler(func(e events.PlayerHurt) {
+		handler(
+			cs2PlayerInfo(e.Attacker),
+			cs2PlayerInfo(e.Player),
+			e.HealthDamageTaken,
+			cs2EquipmentType(e.Weapon),
+			int(e.HitGroup),
+		)
+	})
+}
+
+func (s cs2GameState) handleMatchStart(handler func()) {
+	s.p.RegisterEventHandler(func(e events.MatchStart) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handleRoundStart(handler func()) {
+	s.p.RegisterEventHandler(func(e events.RoundStart) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handleFreezetimeEnd(handler func()) {
+	s.p.RegisterEventHandler(func(e events.RoundFreezetimeEnd) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handleTeamSideSwitch(handler func()) {
+	s.p.RegisterEventHandler(func(e events.TeamSideSwitch) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handlePlayerDisconnected(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.PlayerDisconnected) {
+		handler(cs2PlayerInfo(e.Player))
+	})
+}
+
+func (s cs2GameState) handleFrameDone(handler func()) {
+	s.p.RegisterEventHandler(func(e events.FrameDone) {
+		handler()
+	})
+}
+
+func (s cs2GameState) handleRoundEnd(handler func(string, int)) {
+	s.p.RegisterEventHandler(func(e events.RoundEnd) {
+		handler(cs2Team(e.Winner), int(e.Reason))
+	})
+}
+
+func parseCs2Demo(
+	f io.Reader,
+	demoTypes *demoTypeDetector,
+	cancelOnModeChange bool,
+	config Config,
+	logger *Logger,
+) (*parseState, error) {
+	p := dem.NewParser(f)
+	defer p.Close()
+
+	_, err := p.ParseHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	source := cs2GameState{p}
+	state := newParseState(source, demoTypes, config, logger)
+	if cancelOnModeChange {
+		state.cancel = p.Cancel
+	}
+
+	// CS2 demo headers don't have the map or server name in them, they're
+	// sent in the server info message instead
+	p.RegisterNetMessageHandler(func(m *msgs2.CSVCMsg_ServerInfo) {
+		state.setMapName(m.GetMapName())
+		state.onServerName(m.GetHostName())
+	})
+
+	registerEventHandlers(source, state)
+
+	err = p.ParseToEnd()
+	if errors.Is(err, dem.ErrCancelled) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.setRoundLimits(p.GameState().Rules().ConVars(), Cs2DefaultMaxRounds)
+	return state, nil
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	r2 "github.com/golang/geo/r2"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+type csgoGameState struct {
+	p dem.Parser
+}
+
+func (s csgoGameState) currentTime() time.Duration {
+	return s.p.CurrentTime()
+}
+
+func (s csgoGameState) participants() []playerInfo {
+	return csgoPlayerInfos(s.p.GameState().Participants().All())
+}
+
+func (s csgoGameState) playing() []playerInfo {
+	return csgoPlayerInfos(s.p.GameState().Participants().Playing())
+}
+
+func (s csgoGameState) clanNames() (string, string) {
+	return s.p.GameState().TeamCounterTerrorists().ClanName(),
+		s.p.GameState().TeamTerrorists().ClanName()
+}
+
+func (s csgoGameState) teamScores() (int, int) {
+	return s.p.GameState().TeamCounterTerrorists().Score(),
+		s.p.GameState().TeamTerrorists().Score()
+}
+
+func csgoTeam(team common.Team) string {
+	switch team {
+	case common.TeamCounterTerrorists:
+		return "CT"
+	case common.TeamTerrorists:
+		return "T"
+	}
+	return ""
+}
+
+func csgoPlayerInfo(player *common.Player) *playerInfo {
+	if player == nil {
+		return nil
+	}
+
+	position := player.Position()
+	return &playerInfo{
+		id:             unBotify(player.SteamID64),
+		userId:         player.UserID,
+		name:           player.Name,
+		isBot:          player.IsBot,
+		isConnected:    player.IsConnected,
+		isAlive:        player.IsAlive(),
+		team:           csgoTeam(player.Team),
+		place:          player.LastPlaceName(),
+		x:              position.X,
+		y:              position.Y,
+		yaw:            player.ViewDirectionX(),
+		health:         player.Health(),
+		weapon:         csgoEquipmentType(player.ActiveWeapon()),
+		money:          player.Money(),
+		moneySpent:     player.MoneySpentThisRound(),
+		equipmentValue: player.EquipmentValueCurrent(),
+	}
+}
+
+func csgoPlayerInfos(players []*common.Player) []playerInfo {
+	ret := make([]playerInfo, 0, len(players))
+	for _, player := range players {
+		ret = append(ret, *csgoPlayerInfo(player))
+	}
+	return ret
+}
+
+func csgoEquipmentType(weapon *common.Equipment) common.EquipmentType {
+	if weapon == nil {
+		return common.EqUnknown
+	}
+	return weapon.Type
+}
+
+func (s csgoGameState) handleConVarsUpdated(handler func(map[string]string)) {
+	s.p.RegisterEventHandler(func(e events.ConVarsUpdated) {
+		handler(e.UpdatedConVars)
+	})
+}
+
+func (s csgoGameState) handleSayText(handler func(string)) {
+	s.p.RegisterEventHandler(func(e events.SayText) {
+		handler(e.Text)
+	})
+}
+
+func (s csgoGameState) handleSayText2(handler func(string, []string)) {
+	s.p.RegisterEventHandler(func(e events.SayText2) {
+		handler(e.MsgName, e.Params)
+	})
+}
+
+func (s csgoGameState) handleKill(handler func(*playerInfo, *playerInfo, *playerInfo, common.EquipmentType, Kill)) {
+	s.p.RegisterEventHandler(func(e events.Kill) {
+		weapon := ""
+		if e.Weapon != nil {
+			weapon = processWeaponName(*e.Weapon)
+		}
+
+		handler(
+			csgoPlayerInfo(e.Killer),
+			csgoPlayerInfo(e.Victim),
+			csgoPlayerInfo(e.Assister),
+			csgoEquipmentType(e.Weapon),
+			Kill{
+				Weapon:            weapon,
+				IsHeadshot:        e.IsHeadshot,
+				AttackerBlind:     e.AttackerBlind,
+				AssistedFlash:     e.AssistedFlash,
+				NoScope:           e.NoScope,
+				ThroughSmoke:      e.ThroughSmoke,
+				PenetratedObjects: e.PenetratedObjects,
+			},
+		)
+	})
+}
+
+func (s csgoGameState) handlePlayerFlashed(handler func(*playerInfo, *playerInfo, time.Duration, int64)) {
+	s.p.RegisterEventHandler(func(e events.PlayerFlashed) {
+		var grenadeId int64
+		if e.Projectile != nil {
+			grenadeId = e.Projectile.UniqueID()
+		}
+
+		handler(csgoPlayerInfo(e.Attacker), csgoPlayerInfo(e.Player), e.FlashDuration(), grenadeId)
+	})
+}
+
+func (s csgoGameState) handleBombDefused(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.BombDefused) {
+		handler(csgoPlayerInfo(e.Player))
+	})
+}
+
+func (s csgoGameState) handleBombPlanted(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.BombPlanted) {
+		handler(csgoPlayerInfo(e.Player))
+	})
+}
+
+func (s csgoGameState) handleBombExplode(handler func()) {
+	s.p.RegisterEventHandler(func(e events.BombExplode) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handleWeaponFire(handler func(*playerInfo, common.EquipmentType)) {
+	s.p.RegisterEventHandler(func(e events.WeaponFire) {
+		handler(csgoPlayerInfo(e.Shooter), csgoEquipmentType(e.Weapon))
+	})
+}
+
+func (s csgoGameState) handleGrenadeThrow(handler func(int64, int, *playerInfo, common.EquipmentType)) {
+	s.p.RegisterEventHandler(func(e events.GrenadeProjectileThrow) {
+		handler(
+			e.Projectile.UniqueID(),
+			e.Projectile.Entity.ID(),
+			csgoPlayerInfo(e.Projectile.Thrower),
+			csgoEquipmentType(e.Projectile.WeaponInstance),
+		)
+	})
+}
+
+func (s csgoGameState) handleGrenadeDestroy(handler func(int64, int, float64, float64, []r2.Point)) {
+	s.p.RegisterEventHandler(func(e events.GrenadeProjectileDestroy) {
+		trajectory := make([]r2.Point, 0, len(e.Projectile.Trajectory))
+		for _, point := range e.Projectile.Trajectory {
+			trajectory = append(trajectory, r2.Point{X: point.X, Y: point.Y})
+		}
+
+		position := e.Projectile.Position()
+		handler(e.Projectile.UniqueID(), e.Projectile.Entity.ID(), position.X, position.Y, trajectory)
+	})
+}
+
+func (s csgoGameState) handleGrenadeDetonate(handler func(int, *playerInfo, float64, float64)) {
+	onGrenade := func(e events.GrenadeEvent) {
+		handler(e.GrenadeEntityID, csgoPlayerInfo(e.Thrower), e.Position.X, e.Position.Y)
+	}
+
+	s.p.RegisterEventHandler(func(e events.HeExplode) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.FlashExplode) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.SmokeStart) {
+		onGrenade(e.GrenadeEvent)
+	})
+
+	s.p.RegisterEventHandler(func(e events.FireGrenadeStart) {
+		onGrenade(e.GrenadeEvent)
+	})
+}
+
+func (s csgoGameState) handlePlayerHurt(handler func(*playerInfo, *playerInfo, int, common.EquipmentType, int)) {
+	s.p.RegisterEventHandler(func(e events.PlayerHurt) {
+		handler(
+			csgoPlayerInfo(e.Attacker),
+			csgoPlayerInfo(e.Player),
+			e.HealthDamageTaken,
+			csgoEquipmentType(e.Weapon),
+			int(e.HitGroup),
+		)
+	})
+}
+
+func (s csgoGameState) handleMatchStart(handler func()) {
+	s.p.RegisterEventHandler(func(e events.MatchStart) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handleRoundStart(handler func()) {
+	s.p.RegisterEventHandler(func(e events.RoundStart) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handleFreezetimeEnd(handler func()) {
+	s.p.RegisterEventHandler(func(e events.RoundFreezetimeEnd) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handleTeamSideSwitch(handler func()) {
+	s.p.RegisterEventHandler(func(e events.TeamSideSwitch) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handlePlayerDisconnected(handler func(*playerInfo)) {
+	s.p.RegisterEventHandler(func(e events.PlayerDisconnected) {
+		handler(csgoPlayerInfo(e.Player))
+	})
+}
+
+func (s csgoGameState) handleFrameDone(handler func()) {
+	s.p.RegisterEventHandler(func(e events.FrameDone) {
+		handler()
+	})
+}
+
+func (s csgoGameState) handleRoundEnd(handler func(string, int)) {
+	s.p.RegisterEventHandler(func(e events.RoundEnd) {
+		handler(csgoTeam(e.Winner), int(e.Reason))
+	})
+}
+
+func parseCsgoDemo(
+	f io.Reader,
+	demoTypes *demoTypeDetector,
+	cancelOnModeChange bool,
+	config Config,
+	logger *Logger,
+) (*parseState, error) {
+	p := dem.NewParser(f)
+	defer p.Close()
+
+	header, err := p.ParseHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	source := csgoGameState{p}
+	state := newParseState(source, demoTypes, config, logger)
+	if cancelOnModeChange {
+		state.cancel = p.Cancel
+	}
+	state.setMapName(header.MapName)
+	state.onServerName(header.ServerName)
+	registerEventHandlers(source, state)
+
+	err = p.ParseToEnd()
+	if errors.Is(err, dem.ErrCancelled) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Older demos don't always have mp_maxrounds, in which case the half
+	// length is worked out from the score
+	state.setRoundLimits(p.GameState().Rules().ConVars(), 0)
+	return state, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	r2 "github.com/golang/geo/r2"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+)
+
+// The demo events that parseState listens to. Each game converts the
+// events from its version of demoinfocs into these so that the handling
+// of them (see registerEventHandlers) only has to be written once
+type demoEventSource interface {
+	gameStateSource
+
+	handleConVarsUpdated(handler func(conVars map[string]string))
+	handleSayText(handler func(text string))
+	handleSayText2(handler func(msgName string, params []string))
+	handleKill(handler func(killer, victim, assister *playerInfo, weapon common.EquipmentType, kill Kill))
+	handlePlayerFlashed(handler func(attacker, player *playerInfo, duration time.Duration, grenadeId int64))
+	handleBombDefused(handler func(player *playerInfo))
+	handleBombPlanted(handler func(player *playerInfo))
+	handleBombExplode(handler func())
+	handleWeaponFire(handler func(shooter *playerInfo, weapon common.EquipmentType))
+	handleGrenadeThrow(handler func(id int64, entityId int, thrower *playerInfo, weapon common.EquipmentType))
+	handleGrenadeDestroy(handler func(id int64, entityId int, x, y float64, trajectory []r2.Point))
+	// HEs and flashes going off, and smokes and molotovs starting
+	handleGrenadeDetonate(handler func(entityId int, thrower *playerInfo, x, y float64))
+	handlePlayerHurt(handler func(attacker, player *playerInfo, healthDamage int, weapon common.EquipmentType, hitGroup int))
+	handleMatchStart(handler func())
+	handleRoundStart(handler func())
+	handleFreezetimeEnd(handler func())
+	handleTeamSideSwitch(handler func())
+	handlePlayerDisconnected(handler func(player *playerInfo))
+	handleFrameDone(handler func())
+	handleRoundEnd(handler func(winner string, reason int))
+}
+
+func registerEventHandlers(source demoEventSource, state *parseState) {
+	source.handleConVarsUpdated(state.onConVarsUpdated)
+	source.handleSayText(state.onServerMessage)
+
+	// Player chat comes through as SayText2 too and shouldn't be
+	// used to work out the demo type
+	source.handleSayText2(func(msgName string, params []string) {
+		if !strings.HasPrefix(msgName, "Cstrike_Chat") {
+			state.onServerMessage(msgName + " " + strings.Join(params, " "))
+		}
+	})
+
+	source.handleKill(state.onKill)
+
+	source.handlePlayerFlashed(func(attacker, player *playerInfo, duration time.Duration, grenadeId int64) {
+		if player != nil {
+			state.onPlayerFlashed(attacker, player, duration.Milliseconds(), grenadeId)
+		}
+	})
+
+	source.handleBombDefused(func(player *playerInfo) {
+		if player != nil {
+			state.onBombDefused(player)
+		}
+	})
+
+	source.handleBombPlanted(func(player *playerInfo) {
+		if player != nil {
+			state.onBombPlanted(player)
+		}
+	})
+
+	source.handleBombExplode(state.onBombExplode)
+	source.handleWeaponFire(state.onWeaponFire)
+	source.handleGrenadeThrow(state.onGrenadeThrow)
+	source.handleGrenadeDestroy(state.onGrenadeDestroy)
+
+	// Grenades are recorded where they go off rather than where they
+	// were thrown from
+	source.handleGrenadeDetonate(state.onGrenadeDetonate)
+
+	source.handlePlayerHurt(state.onPlayerHurt)
+	source.handleMatchStart(state.onMatchStart)
+
+	source.handleRoundStart(func() {
+		ct, t := source.teamScores()
+		state.logger.DebugBig("ROUND START")
+		state.logger.Debugf("CT %d - %d T", ct, t)
+		state.onRoundStart()
+	})
+
+	source.handleFreezetimeEnd(state.onFreezetimeEnd)
+	source.handleTeamSideSwitch(state.onTeamSideSwitch)
+	source.handlePlayerDisconnected(state.onPlayerDisconnected)
+	source.handleFrameDone(state.onFrameDone)
+
+	source.handleRoundEnd(func(winner string, reason int) {
+		state.logger.Debugf("round end winner=%s reason=%d", winner, reason)
+		state.onRoundEnd(winner, reason)
+	})
+}
+
+// Picks up mp_maxrounds and mp_overtime_maxrounds from the ConVars the
+// demo ended with. defaultMaxRounds is used if the demo doesn't have
+// mp_maxrounds, 0 means it's worked out from the score later on
+func (s *parseState) setRoundLimits(conVars map[string]string, defaultMaxRounds int) {
+	s.maxRounds = defaultMaxRounds
+	maxRounds, err := strconv.Atoi(conVars["mp_maxrounds"])
+	if err == nil {
+		s.maxRounds = maxRounds
+	}
+
+	overtimeMaxRounds, err := strconv.Atoi(conVars["mp_overtime_maxrounds"])
+	if err == nil {
+		s.overtimeMaxRounds = overtimeMaxRounds
+	}
+}
@@ -0,0 +1,823 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"time"
+
+	r2 "github.com/golang/geo/r2"
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	metadata "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/metadata"
+)
+
+// The CS:GO and CS2 parsers come from different major versions of
+// demoinfocs so their types aren't compatible with each other. Each parser
+// converts its players into this struct before handing the event off to
+// the parseState, that way the stats logic only has to be written once.
+type playerInfo struct {
+	id          uint64 // unBotified steam ID
+	userId      int    // unique per connection, unlike id (bots all share one id)
+	name        string
+	isBot       bool
+	isConnected bool
+	isAlive     bool
+	// "CT", "T" or "" for spectators and unassigned players
+	team  string
+	place string
+	x, y  float64
+	yaw   float32
+
+	health int
+	weapon common.EquipmentType
+
+	money          int
+	moneySpent     int
+	equipmentValue int
+}
+
+// The parts of the game state that parseState needs to look at directly
+type gameStateSource interface {
+	currentTime() time.Duration
+	// All players (including disconnected ones)
+	participants() []playerInfo
+	// Players on either the CT or T side
+	playing() []playerInfo
+	clanNames() (ct string, t string)
+	teamScores() (ct int, t int)
+}
+
+const (
+	// How often to sample the player positions for the 2D replays
+	ReplayFrameIntervalMs = 250
+
+	// Teammates within this many units of a player when they die are
+	// expected to trade them
+	TradeDistance = 800
+)
+
+type parseState struct {
+	source gameStateSource
+	logger *Logger
+
+	mapName     string
+	mapMetadata metadata.Map
+	// Positions can't be placed on the radar without the map metadata so
+	// they aren't recorded for maps we don't know
+	hasMapMetadata bool
+	// mp_maxrounds if the demo has it, otherwise 0
+	maxRounds int
+	// mp_overtime_maxrounds if the demo has it, otherwise 0. The
+	// default is used when we can't work it out from the scores
+	overtimeMaxRounds     int
+	defaultOvertimeLength int
+
+	prd PerRoundData
+
+	teams       TeamsMap
+	playerNames NamesMap
+
+	// Only tracked for one round for use in KAST and RWS
+	bombPlanter     uint64
+	bombDefuser     uint64
+	bombPlanterTime int64
+	bombDefuserTime int64
+	roundStartTime  int64
+	bombExplodeTime int64
+
+	ctClanTag string
+	tClanTag  string
+
+	// Evidence for where the demo came from and the type the live round
+	// handling was decided with
+	demoTypes *demoTypeDetector
+	parsedAs  string
+	// Set when the parse should stop as soon as the demo type changes
+	// after the rounds have started, see updateDemoMode
+	cancel func()
+
+	consecutiveMatchStarts int
+	eseaMode               bool
+	valveMode              bool
+	isLive                 bool
+	// No replay frames are recorded between the end of one round
+	// and the start of the next
+	roundEnded    bool
+	lastFrameTime int64
+
+	// How long after a player dies a teammate can kill their killer for
+	// it to count as a trade, in milliseconds
+	tradeWindow int64
+
+	leavers   map[uint64]uint64
+	lastHits  map[uint64]weaponHit
+	lastShots map[uint64]weaponShot
+
+	// Grenades that are still in the air or still going, by projectile
+	// ID and entity ID. Entity IDs get reused but only after the
+	// grenade is gone
+	grenades        map[int64]*Grenade
+	grenadeEntities map[int]*Grenade
+}
+
+func newParseState(source gameStateSource, demoTypes *demoTypeDetector, config Config, logger *Logger) *parseState {
+	s := &parseState{
+		source:      source,
+		logger:      logger,
+		demoTypes:   demoTypes,
+		tradeWindow: int64(config.tradeWindowSeconds) * 1000,
+		leavers:     make(map[uint64]uint64),
+		lastHits:    make(map[uint64]weaponHit),
+		lastShots:   make(map[uint64]weaponShot),
+
+		grenades:        make(map[int64]*Grenade),
+		grenadeEntities: make(map[int]*Grenade),
+
+		defaultOvertimeLength: config.overtimeMaxRounds,
+	}
+
+	s.updateDemoMode()
+	return s
+}
+
+// ESEA and matchmaking demos have warmup and knife rounds that we need to
+// skip, which is decided as the rounds start. The demo type can change
+// until then as we learn more about the demo
+func (s *parseState) updateDemoMode() {
+	if len(s.prd.rounds) > 0 {
+		// The rounds so far were handled with the wrong type and the demo
+		// has to be parsed again, so there's no point reading any further
+		if s.cancel != nil && s.demoModeChanged() {
+			s.cancel()
+			s.cancel = nil
+		}
+		return
+	}
+
+	demoType := s.demoTypes.demoType()
+	s.eseaMode = demoType == DemoTypeEsea
+	s.valveMode = demoType == DemoTypeSteam
+	s.isLive = !s.eseaMode && !s.valveMode
+	s.parsedAs = demoType
+}
+
+func (s *parseState) onServerName(name string) {
+	s.demoTypes.onServerName(name)
+	s.updateDemoMode()
+}
+
+func (s *parseState) onConVarsUpdated(conVars map[string]string) {
+	s.demoTypes.onConVars(conVars)
+	s.updateDemoMode()
+}
+
+func (s *parseState) onServerMessage(text string) {
+	s.demoTypes.onServerMessage(text)
+	s.updateDemoMode()
+}
+
+// Whether the demo type we ended up with needs different live round
+// handling to the one the demo was parsed with
+func (s *parseState) demoModeChanged() bool {
+	demoType := s.demoTypes.demoType()
+	return (demoType == DemoTypeEsea) != (s.parsedAs == DemoTypeEsea) ||
+		(demoType == DemoTypeSteam) != (s.parsedAs == DemoTypeSteam)
+}
+
+// The radar position and scale of the map. ok is false for maps we don't
+// have metadata for, like community maps. v4 of the demo parser doesn't
+// ship map metadata so CS2 demos use the same table
+func getMapMetadata(mapName string) (mapMetadata metadata.Map, ok bool) {
+	mapMetadata, ok = metadata.MapNameToMap[mapName]
+	return mapMetadata, ok && mapMetadata.Scale != 0
+}
+
+func (s *parseState) setMapName(mapName string) {
+	s.mapName = mapName
+	s.mapMetadata, s.hasMapMetadata = getMapMetadata(mapName)
+	if !s.hasMapMetadata {
+		s.logger.Warnf("map=%s no metadata for map, positions, heatmaps, replays and utility won't be recorded", mapName)
+	}
+}
+
+// Record a position event for the current round. x and y are the
+// in-game coordinates
+func (s *parseState) addPosition(kind string, player *playerInfo, x, y float64) {
+	prd := &s.prd
+	if len(prd.positions) == 0 || player == nil || !s.hasMapMetadata {
+		return
+	}
+
+	radarX, radarY := s.mapMetadata.TranslateScale(x, y)
+	prd.positions[len(prd.positions)-1] = append(prd.positions[len(prd.positions)-1], PositionEvent{
+		Kind:   kind,
+		Player: player.id,
+		Side:   player.team,
+		X:      radarX,
+		Y:      radarY,
+	})
+}
+
+// milliseconds since the start of the current round
+func (s *parseState) roundTime() int64 {
+	return s.source.currentTime().Milliseconds() - s.roundStartTime
+}
+
+func (s *parseState) onKill(killer, victim, assister *playerInfo, weapon common.EquipmentType, kill Kill) {
+	prd := &s.prd
+	if len(prd.kills) == 0 {
+		return
+	}
+
+	if victim != nil {
+		prd.deaths[len(prd.deaths)-1][victim.id] += 1
+		s.addPosition(PositionDeath, victim, victim.x, victim.y)
+	}
+
+	if assister != nil && victim != nil && assister.team != victim.team {
+		if kill.AssistedFlash {
+			prd.flashAssists[len(prd.flashAssists)-1][assister.id] += 1
+		} else {
+			prd.assists[len(prd.assists)-1][assister.id] += 1
+		}
+	}
+
+	if killer != nil && victim != nil && killer.team != victim.team {
+		prd.kills[len(prd.kills)-1][killer.id] += 1
+		s.addPosition(PositionKill, killer, killer.x, killer.y)
+
+		if kill.IsHeadshot {
+			prd.headshots[len(prd.headshots)-1][killer.id] += 1
+		}
+
+		prd.weapons[len(prd.weapons)-1].update(killer.id, weapon, func(w *WeaponStats) {
+			w.Kills += 1
+			if kill.IsHeadshot {
+				w.Headshots += 1
+			}
+		})
+
+		if prd.headToHead[len(prd.headToHead)-1][killer.id] == nil {
+			prd.headToHead[len(prd.headToHead)-1][killer.id] = make(map[uint64]Kill)
+		}
+
+		if assister != nil {
+			kill.Assister = assister.id
+		}
+
+		kill.Time = s.roundTime()
+		kill.AttackerLocation = killer.place
+		kill.VictimLocation = victim.place
+
+		if prd.openings[len(prd.openings)-1] == nil {
+			prd.openings[len(prd.openings)-1] = &OpeningKill{
+				Kill:     kill,
+				Attacker: killer.id,
+				Victim:   victim.id,
+			}
+		}
+
+		prd.headToHead[len(prd.headToHead)-1][killer.id][victim.id] = kill
+
+		// check for trade kills
+		trades := prd.trades[len(prd.trades)-1]
+		for i := range trades {
+			trade := &trades[i]
+			if trade.Killer == victim.id && trade.Trader == 0 && kill.Time-trade.DeathTime <= s.tradeWindow {
+				trade.Trader = killer.id
+				trade.TradeTime = kill.Time
+				prd.deathsTraded[len(prd.deathsTraded)-1][trade.Traded] += 1
+				prd.tradeKills[len(prd.tradeKills)-1][killer.id] += 1
+			}
+		}
+
+		prd.trades[len(prd.trades)-1] = append(trades, Trade{
+			Traded:    victim.id,
+			Killer:    killer.id,
+			DeathTime: kill.Time,
+			Nearby:    s.nearbyTeammates(victim),
+		})
+	}
+
+	// check if someone is now left alone against the other team
+	if prd.clutches[len(prd.clutches)-1] == nil {
+		ctAlive, tAlive := s.alivePlayers(victim)
+
+		var clutcher *playerInfo
+		var side string
+		var opponents int
+
+		if len(ctAlive) == 1 && len(tAlive) > 0 {
+			clutcher, side, opponents = &ctAlive[0], "CT", len(tAlive)
+		} else if len(tAlive) == 1 && len(ctAlive) > 0 {
+			clutcher, side, opponents = &tAlive[0], "T", len(ctAlive)
+		}
+
+		if clutcher != nil {
+			s.logger.Debugf("%s is in a 1v%d clutch", clutcher.name, opponents)
+			prd.clutches[len(prd.clutches)-1] = &Clutch{
+				Player:    clutcher.id,
+				Side:      side,
+				Opponents: opponents,
+				Time:      s.roundTime(),
+			}
+		}
+	}
+}
+
+// grenadeId is the projectile ID of the flash, or 0 if we don't know it
+func (s *parseState) onPlayerFlashed(attacker, player *playerInfo, blindMs int64, grenadeId int64) {
+	prd := &s.prd
+	if len(prd.kills) == 0 || attacker == nil || player == nil {
+		return
+	}
+
+	if grenade, ok := s.grenades[grenadeId]; ok && blindMs > 0 {
+		if grenade.Blinded == nil {
+			grenade.Blinded = make(PlayerIntMap)
+		}
+		grenade.Blinded[player.id] = int(blindMs)
+	}
+
+	// https://counterstrike.fandom.com/wiki/Flashbang
+	if blindMs > 1950 {
+		if attacker.team == player.team {
+			prd.teammatesFlashed[len(prd.teammatesFlashed)-1][attacker.id] += 1
+		} else {
+			prd.enemiesFlashed[len(prd.enemiesFlashed)-1][attacker.id] += 1
+		}
+	}
+}
+
+func (s *parseState) onBombDefused(player *playerInfo) {
+	s.bombDefuser = player.id
+	s.bombDefuserTime = s.roundTime()
+}
+
+func (s *parseState) onBombPlanted(player *playerInfo) {
+	s.bombPlanter = player.id
+	s.bombPlanterTime = s.roundTime()
+	s.addPosition(PositionPlant, player, player.x, player.y)
+}
+
+func (s *parseState) onBombExplode() {
+	s.bombExplodeTime = s.roundTime()
+}
+
+func (s *parseState) onWeaponFire(shooter *playerInfo, weapon common.EquipmentType) {
+	prd := &s.prd
+	if shooter == nil || prd.flashesThrown == nil {
+		return
+	}
+
+	if weapon == common.EqFlash {
+		prd.flashesThrown[len(prd.flashesThrown)-1][shooter.id] += 1
+	}
+
+	if weapon == common.EqHE {
+		prd.HEsThrown[len(prd.HEsThrown)-1][shooter.id] += 1
+	}
+
+	if weapon == common.EqMolotov || weapon == common.EqIncendiary {
+		prd.molliesThrown[len(prd.molliesThrown)-1][shooter.id] += 1
+	}
+
+	if weapon == common.EqSmoke {
+		prd.smokesThrown[len(prd.smokesThrown)-1][shooter.id] += 1
+	}
+
+	if weapon.Class() != common.EqClassGrenade {
+		s.addPosition(PositionShot, shooter, shooter.x, shooter.y)
+	}
+
+	if isGun(weapon) && len(prd.weapons) != 0 {
+		now := s.source.currentTime().Milliseconds()
+		lastShot, ok := s.lastShots[shooter.id]
+		first := !ok || lastShot.weapon != weapon || now-lastShot.time > FirstShotResetMs
+		s.lastShots[shooter.id] = weaponShot{weapon: weapon, time: now, first: first}
+
+		prd.weapons[len(prd.weapons)-1].update(shooter.id, weapon, func(w *WeaponStats) {
+			w.Shots += 1
+			if first {
+				w.FirstShots += 1
+			}
+		})
+	}
+}
+
+func (s *parseState) onGrenadeThrow(id int64, entityId int, thrower *playerInfo, weapon common.EquipmentType) {
+	prd := &s.prd
+	kind := grenadeKind(weapon)
+	if len(prd.grenades) == 0 || thrower == nil || kind == "" || !s.hasMapMetadata {
+		return
+	}
+
+	grenade := &Grenade{
+		Thrower:   thrower.id,
+		Side:      thrower.team,
+		Kind:      kind,
+		ThrowTime: s.roundTime(),
+		Throw:     toRadarPoint(s.mapMetadata, thrower.x, thrower.y),
+		// Filled in once the grenade is gone
+		Trajectory: make([]RadarPoint, 0),
+	}
+
+	prd.grenades[len(prd.grenades)-1] = append(prd.grenades[len(prd.grenades)-1], grenade)
+	s.grenades[id] = grenade
+	s.grenadeEntities[entityId] = grenade
+}
+
+func (s *parseState) landGrenade(grenade *Grenade, x, y float64) {
+	if grenade.landed {
+		return
+	}
+
+	grenade.landed = true
+	grenade.DetonateTime = s.roundTime()
+	grenade.Land = toRadarPoint(s.mapMetadata, x, y)
+}
+
+// x and y are where the grenade went off, not where the thrower is
+func (s *parseState) onGrenadeDetonate(entityId int, thrower *playerInfo, x, y float64) {
+	s.addPosition(PositionGrenade, thrower, x, y)
+
+	if grenade, ok := s.grenadeEntities[entityId]; ok {
+		s.landGrenade(grenade, x, y)
+	}
+}
+
+// Called when the grenade entity is removed. Molotovs don't have a
+// detonate event that we can match up with the grenade so they land here.
+// x and y are the last known position of the grenade
+func (s *parseState) onGrenadeDestroy(id int64, entityId int, x, y float64, trajectory []r2.Point) {
+	grenade, ok := s.grenades[id]
+	if !ok {
+		return
+	}
+
+	s.landGrenade(grenade, x, y)
+	grenade.Trajectory = toRadarTrajectory(s.mapMetadata, trajectory)
+
+	delete(s.grenades, id)
+	if s.grenadeEntities[entityId] == grenade {
+		delete(s.grenadeEntities, entityId)
+	}
+}
+
+// Find the grenade of the given kind that just hurt someone. HE damage
+// happens on the same tick as the explosion but the events can come in
+// either order, so if none of the player's HEs went off this tick it's
+// the oldest one that hasn't gone off yet. Molotov damage is put on the
+// player's most recent molotov
+func (s *parseState) damagingGrenade(thrower uint64, kind string) *Grenade {
+	grenades := s.prd.grenades[len(s.prd.grenades)-1]
+	now := s.roundTime()
+
+	var notLanded *Grenade
+	for i := len(grenades) - 1; i >= 0; i-- {
+		grenade := grenades[i]
+		if grenade.Thrower != thrower || grenade.Kind != kind {
+			continue
+		}
+
+		if !grenade.landed {
+			notLanded = grenade
+		} else if kind != GrenadeHE || grenade.DetonateTime == now {
+			return grenade
+		}
+	}
+
+	if kind == GrenadeHE {
+		return notLanded
+	}
+	return nil
+}
+
+func (s *parseState) onPlayerHurt(
+	attacker, player *playerInfo,
+	healthDamage int,
+	weapon common.EquipmentType,
+	hitGroup int,
+) {
+	prd := &s.prd
+	if len(prd.damage) == 0 {
+		return
+	}
+
+	if attacker != nil && player != nil && attacker.team != player.team {
+		prd.damage[len(prd.damage)-1][attacker.id] += healthDamage
+
+		if weapon == common.EqHE ||
+			weapon == common.EqMolotov ||
+			weapon == common.EqIncendiary {
+			prd.utilDamage[len(prd.utilDamage)-1][attacker.id] += healthDamage
+
+			if grenade := s.damagingGrenade(attacker.id, grenadeKind(weapon)); grenade != nil {
+				if grenade.Damage == nil {
+					grenade.Damage = make(PlayerIntMap)
+				}
+				grenade.Damage[player.id] += healthDamage
+			}
+		}
+
+		now := s.source.currentTime().Milliseconds()
+		hit := weaponHit{victim: player.id, weapon: weapon, time: now}
+		newHit := s.lastHits[attacker.id] != hit
+		s.lastHits[attacker.id] = hit
+
+		// Bullets hit on the same tick they're fired
+		lastShot := s.lastShots[attacker.id]
+		firstShotHit := lastShot.first && lastShot.weapon == weapon && lastShot.time == now
+		if firstShotHit {
+			lastShot.first = false
+			s.lastShots[attacker.id] = lastShot
+		}
+
+		prd.weapons[len(prd.weapons)-1].update(attacker.id, weapon, func(w *WeaponStats) {
+			w.Damage += healthDamage
+			if newHit && isGun(weapon) {
+				w.Hits += 1
+				w.addHitGroup(hitGroup)
+			}
+			if firstShotHit {
+				w.FirstShotHits += 1
+			}
+		})
+	}
+}
+
+func (s *parseState) onMatchStart() {
+	prd := &s.prd
+	if prd.isLive == nil {
+		return
+	}
+
+	s.logger.DebugBig("MATCH START EVENT")
+
+	if s.valveMode {
+		// The MatchStart event comes after the RoundStart event so we need to
+		// set the current round's live status in addition to updating the isLive variable.
+		// Same thing goes for the ESEA demo code below
+		prd.isLive[len(prd.isLive)-1] = true
+		s.isLive = true
+	}
+
+	if s.eseaMode {
+		if s.consecutiveMatchStarts < 3 {
+			prd.isLive[len(prd.isLive)-1] = false
+			s.isLive = false
+			s.logger.DebugBig("NOT LIVE")
+			s.consecutiveMatchStarts += 1
+		} else {
+			prd.isLive[len(prd.isLive)-1] = true
+			s.isLive = true
+			s.logger.DebugBig("GOING LIVE")
+			s.consecutiveMatchStarts = 0
+		}
+	}
+}
+
+// Create a new 'round' map in each of the stats arrays
+func (s *parseState) onRoundStart() {
+	s.prd.NewRound(s.isLive)
+
+	s.bombDefuser = 0
+	s.bombPlanter = 0
+	s.roundStartTime = s.source.currentTime().Milliseconds()
+	s.bombExplodeTime = 0
+	s.bombPlanterTime = 0
+	s.bombDefuserTime = 0
+	s.roundEnded = false
+	s.lastFrameTime = 0
+
+	if s.teams == nil {
+		s.teams = make(TeamsMap)
+	}
+
+	if s.playerNames == nil {
+		s.playerNames = make(NamesMap)
+	}
+
+	s.updatePlayerNames()
+	s.updateTeams()
+}
+
+// Money has been spent by the time the freeze time ends so this is
+// where we take our snapshot of each player's economy for the round
+func (s *parseState) onFreezetimeEnd() {
+	prd := &s.prd
+	if len(prd.rounds) == 0 {
+		return
+	}
+
+	round := &prd.rounds[len(prd.rounds)-1]
+	round.CTEconomy = TeamEconomy{}
+	round.TEconomy = TeamEconomy{}
+
+	for _, player := range s.source.playing() {
+		startMoney := player.money + player.moneySpent
+
+		prd.startMoney[len(prd.startMoney)-1][player.id] += startMoney
+		prd.equipmentValue[len(prd.equipmentValue)-1][player.id] += player.equipmentValue
+		prd.moneySpent[len(prd.moneySpent)-1][player.id] += player.moneySpent
+
+		var teamEconomy *TeamEconomy
+		switch player.team {
+		case "CT":
+			teamEconomy = &round.CTEconomy
+		case "T":
+			teamEconomy = &round.TEconomy
+		default:
+			continue
+		}
+
+		teamEconomy.NumPlayers += 1
+		teamEconomy.StartMoney += startMoney
+		teamEconomy.EquipmentValue += player.equipmentValue
+		teamEconomy.MoneySpent += player.moneySpent
+	}
+}
+
+// Sample every living player's state for the replay of the current round.
+// This is called after every frame so it needs to bail out early most of
+// the time
+func (s *parseState) onFrameDone() {
+	prd := &s.prd
+	if len(prd.frames) == 0 || s.roundEnded || !prd.isLive[len(prd.isLive)-1] || !s.hasMapMetadata {
+		return
+	}
+
+	now := s.source.currentTime().Milliseconds()
+	if s.lastFrameTime != 0 && now-s.lastFrameTime < ReplayFrameIntervalMs {
+		return
+	}
+	s.lastFrameTime = now
+
+	players := make([]ReplayPlayer, 0, 10)
+	for _, player := range s.source.playing() {
+		if !player.isAlive {
+			continue
+		}
+
+		x, y := s.mapMetadata.TranslateScale(player.x, player.y)
+		players = append(players, ReplayPlayer{
+			Id:     player.id,
+			Side:   player.team,
+			X:      int(math.Round(x)),
+			Y:      int(math.Round(y)),
+			Yaw:    int(math.Round(float64(player.yaw))),
+			Health: player.health,
+			Weapon: getWeaponFileName(player.weapon),
+		})
+	}
+
+	prd.frames[len(prd.frames)-1] = append(prd.frames[len(prd.frames)-1], ReplayFrame{
+		Time:    s.roundTime(),
+		Players: players,
+	})
+}
+
+// Update the teams when the side switches
+func (s *parseState) onTeamSideSwitch() {
+	s.logger.DebugBig("SIDE SWITCH")
+	s.updateTeams()
+}
+
+func (s *parseState) onPlayerDisconnected(player *playerInfo) {
+	if player != nil && !player.isBot && s.isLive {
+		leaverTeam := s.teams[player.id]
+		var teammate uint64
+		for p, team := range s.teams {
+			if team == leaverTeam && p != player.id {
+				teammate = p
+			}
+		}
+		s.leavers[player.id] = teammate
+	}
+}
+
+func (s *parseState) onRoundEnd(winner string, reason int) {
+	prd := &s.prd
+	if len(prd.rounds) == 0 {
+		return
+	}
+
+	s.updateTeams()
+	s.roundEnded = true
+
+	// The economy info was already filled in at the end of freeze time
+	// so we need to keep it around
+	round := &prd.rounds[len(prd.rounds)-1]
+	round.Winner = winner
+	round.Reason = reason
+	round.Planter = s.bombPlanter
+	round.Defuser = s.bombDefuser
+	round.PlanterTime = s.bombPlanterTime
+	round.DefuserTime = s.bombDefuserTime
+	round.BombExplodeTime = s.bombExplodeTime
+
+	var roundWinners []uint64
+	for player := range s.teams {
+		if s.teams[player] == winner {
+			roundWinners = append(roundWinners, player)
+		}
+	}
+
+	prd.winners[len(prd.winners)-1] = roundWinners
+
+	if clutch := prd.clutches[len(prd.clutches)-1]; clutch != nil {
+		clutch.Won = clutch.Side == winner
+	}
+}
+
+func (s *parseState) updateTeams() {
+	if s.teams == nil {
+		return
+	}
+
+	// If the teams have custom names we will use those
+	ctTag, tTag := s.source.clanNames()
+	if tTag != "" && ctTag != "" {
+		s.tClanTag = tTag
+		s.ctClanTag = ctTag
+	}
+
+	for _, player := range s.source.participants() {
+		if !player.isConnected {
+			continue
+		}
+
+		if player.team == "" {
+			delete(s.teams, player.id)
+		} else {
+			s.teams[player.id] = player.team
+		}
+	}
+
+	for leaver, teammate := range s.leavers {
+		s.teams[leaver] = s.teams[teammate]
+	}
+}
+
+func (s *parseState) updatePlayerNames() {
+	for _, player := range s.source.playing() {
+		if player.isBot {
+			s.playerNames[player.id] = "BOT " + player.name
+		} else {
+			s.playerNames[player.id] = player.name
+		}
+	}
+}
+
+// Returns the CT and T players that are still alive. The victim might still
+// show up as alive when the Kill event is dispatched so they need to be
+// excluded manually
+func (s *parseState) alivePlayers(victim *playerInfo) ([]playerInfo, []playerInfo) {
+	var ct, t []playerInfo
+	for _, player := range s.source.playing() {
+		if !player.isAlive || (victim != nil && player.userId == victim.userId) {
+			continue
+		}
+
+		switch player.team {
+		case "CT":
+			ct = append(ct, player)
+		case "T":
+			t = append(t, player)
+		}
+	}
+
+	return ct, t
+}
+
+// Teammates of the player that are alive and close enough to trade them
+func (s *parseState) nearbyTeammates(player *playerInfo) []uint64 {
+	var ret []uint64
+	for _, teammate := range s.source.playing() {
+		if teammate.id == player.id || teammate.team != player.team || !teammate.isAlive {
+			continue
+		}
+
+		if math.Hypot(teammate.x-player.x, teammate.y-player.y) <= TradeDistance {
+			ret = append(ret, teammate.id)
+		}
+	}
+	return ret
+}
@@ -25,6 +25,20 @@ type OpeningKill struct {
 	Victim   uint64 `json:"victim,string"`
 }
 
+// Every time a player is killed by an enemy. If one of their teammates
+// kills the killer within the trade window it's a trade
+type Trade struct {
+	Traded uint64
+	Killer uint64
+	// 0 if the death wasn't traded
+	Trader uint64
+	// Milliseconds since the start of the round
+	DeathTime int64
+	TradeTime int64
+	// Teammates that were close enough to trade the death
+	Nearby []uint64
+}
+
 type PerRoundData struct {
 	kills            []PlayerIntMap
 	deaths           []PlayerIntMap
@@ -37,14 +51,24 @@ type PerRoundData struct {
 	enemiesFlashed   []PlayerIntMap
 	teammatesFlashed []PlayerIntMap
 	utilDamage       []PlayerIntMap
+	weapons          []PlayerWeaponMap
 	openings         []*OpeningKill
+	clutches         []*Clutch
+	trades           [][]Trade
 
 	flashesThrown []PlayerIntMap
 	HEsThrown     []PlayerIntMap
 	molliesThrown []PlayerIntMap
 	smokesThrown  []PlayerIntMap
 
+	startMoney     []PlayerIntMap
+	equipmentValue []PlayerIntMap
+	moneySpent     []PlayerIntMap
+
 	headToHead []map[uint64]map[uint64]Kill
+	positions  [][]PositionEvent
+	grenades   [][]*Grenade
+	frames     [][]ReplayFrame
 
 	rounds  []Round
 	winners [][]uint64
@@ -83,14 +107,24 @@ func (prd *PerRoundData) NewRound(isLive bool) {
 	prd.enemiesFlashed = append(prd.enemiesFlashed, make(PlayerIntMap))
 	prd.teammatesFlashed = append(prd.teammatesFlashed, make(PlayerIntMap))
 	prd.utilDamage = append(prd.utilDamage, make(PlayerIntMap))
+	prd.weapons = append(prd.weapons, make(PlayerWeaponMap))
 	prd.openings = append(prd.openings, nil)
+	prd.clutches = append(prd.clutches, nil)
+	prd.trades = append(prd.trades, nil)
 
 	prd.flashesThrown = append(prd.flashesThrown, make(PlayerIntMap))
 	prd.HEsThrown = append(prd.HEsThrown, make(PlayerIntMap))
 	prd.molliesThrown = append(prd.molliesThrown, make(PlayerIntMap))
 	prd.smokesThrown = append(prd.smokesThrown, make(PlayerIntMap))
 
+	prd.startMoney = append(prd.startMoney, make(PlayerIntMap))
+	prd.equipmentValue = append(prd.equipmentValue, make(PlayerIntMap))
+	prd.moneySpent = append(prd.moneySpent, make(PlayerIntMap))
+
 	prd.headToHead = append(prd.headToHead, make(map[uint64]map[uint64]Kill))
+	prd.positions = append(prd.positions, nil)
+	prd.grenades = append(prd.grenades, nil)
+	prd.frames = append(prd.frames, nil)
 
 	prd.rounds = append(prd.rounds, Round{})
 	prd.winners = append(prd.winners, nil)
@@ -112,14 +146,24 @@ func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 		prd.enemiesFlashed = filterByLiveRoundsInt(prd.enemiesFlashed, prd.isLive)
 		prd.teammatesFlashed = filterByLiveRoundsInt(prd.teammatesFlashed, prd.isLive)
 		prd.utilDamage = filterByLiveRoundsInt(prd.utilDamage, prd.isLive)
+		prd.weapons = filterByLiveRoundsWeapons(prd.weapons, prd.isLive)
 		prd.openings = filterByLiveRoundsOpeningKill(prd.openings, prd.isLive)
+		prd.clutches = filterByLiveRoundsClutch(prd.clutches, prd.isLive)
+		prd.trades = filterByLiveRoundsTrades(prd.trades, prd.isLive)
 
 		prd.flashesThrown = filterByLiveRoundsInt(prd.flashesThrown, prd.isLive)
 		prd.HEsThrown = filterByLiveRoundsInt(prd.HEsThrown, prd.isLive)
 		prd.molliesThrown = filterByLiveRoundsInt(prd.molliesThrown, prd.isLive)
 		prd.smokesThrown = filterByLiveRoundsInt(prd.smokesThrown, prd.isLive)
 
+		prd.startMoney = filterByLiveRoundsInt(prd.startMoney, prd.isLive)
+		prd.equipmentValue = filterByLiveRoundsInt(prd.equipmentValue, prd.isLive)
+		prd.moneySpent = filterByLiveRoundsInt(prd.moneySpent, prd.isLive)
+
 		prd.headToHead = filterByLiveRoundsH2H(prd.headToHead, prd.isLive)
+		prd.positions = filterByLiveRoundsPositions(prd.positions, prd.isLive)
+		prd.grenades = filterByLiveRoundsGrenades(prd.grenades, prd.isLive)
+		prd.frames = filterByLiveRoundsFrames(prd.frames, prd.isLive)
 
 		prd.rounds = filterByLiveRoundsRounds(prd.rounds, prd.isLive)
 		prd.winners = filterByLiveRoundsWinners(prd.winners, prd.isLive)
@@ -152,14 +196,24 @@ func (prd *PerRoundData) CropToRealRounds(useLiveMode bool) {
 		prd.enemiesFlashed = prd.enemiesFlashed[startRound+1:]
 		prd.teammatesFlashed = prd.teammatesFlashed[startRound+1:]
 		prd.utilDamage = prd.utilDamage[startRound+1:]
+		prd.weapons = prd.weapons[startRound+1:]
 		prd.openings = prd.openings[startRound+1:]
+		prd.clutches = prd.clutches[startRound+1:]
+		prd.trades = prd.trades[startRound+1:]
 
 		prd.flashesThrown = prd.flashesThrown[startRound+1:]
 		prd.HEsThrown = prd.HEsThrown[startRound+1:]
 		prd.molliesThrown = prd.molliesThrown[startRound+1:]
 		prd.smokesThrown = prd.smokesThrown[startRound+1:]
 
+		prd.startMoney = prd.startMoney[startRound+1:]
+		prd.equipmentValue = prd.equipmentValue[startRound+1:]
+		prd.moneySpent = prd.moneySpent[startRound+1:]
+
 		prd.headToHead = prd.headToHead[startRound+1:]
+		prd.positions = prd.positions[startRound+1:]
+		prd.grenades = prd.grenades[startRound+1:]
+		prd.frames = prd.frames[startRound+1:]
 
 		prd.rounds = prd.rounds[startRound+1:]
 		prd.winners = prd.winners[startRound+1:]
@@ -0,0 +1,304 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MatchResultWin  = "win"
+	MatchResultLoss = "loss"
+	MatchResultTie  = "tie"
+)
+
+// Keeps running totals for a player so that per-round stats can be
+// averaged properly once all of the matches have been added
+type careerAccumulator struct {
+	stats CareerStats
+
+	adrSum         float64
+	hltvSum        float64
+	impactSum      float64
+	kastSum        float64
+	rwsSum         float64
+	headshotPctSum float64
+
+	firstShotsFired int
+	firstShotsHit   int
+}
+
+// Career totals for a player on one map, straight from match_player_stats
+type PlayerMapCareer struct {
+	SteamId    uint64
+	Name       string
+	LastPlayed int64
+	Map        string
+	totals     careerAccumulator
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// Team A is whichever team finished the match on CT
+func playerMatchResult(team string, teamAScore, teamBScore int) string {
+	ownScore, enemyScore := teamAScore, teamBScore
+	if team == "T" {
+		ownScore, enemyScore = enemyScore, ownScore
+	}
+
+	if ownScore > enemyScore {
+		return MatchResultWin
+	} else if ownScore < enemyScore {
+		return MatchResultLoss
+	}
+	return MatchResultTie
+}
+
+// The SQL versions of playerMatchResult and the number of rounds in the
+// match, for use in queries over match_player_stats
+const (
+	playerOwnScoreExpr   = `CASE WHEN match_player_stats.team = 'T' THEN matches.team_b_score ELSE matches.team_a_score END`
+	playerEnemyScoreExpr = `CASE WHEN match_player_stats.team = 'T' THEN matches.team_a_score ELSE matches.team_b_score END`
+	matchRoundsExpr      = `(matches.team_a_score + matches.team_b_score)`
+)
+
+// How each of the totals in careerAccumulator is added up in SQL and
+// where the value ends up. Rate stats are weighted by the number of rounds
+// so they can be averaged properly once the totals are merged
+var careerTotals = []struct {
+	expr string
+	dest func(a *careerAccumulator) interface{}
+}{
+	{`COUNT(*)`, func(a *careerAccumulator) interface{} { return &a.stats.Matches }},
+	{`SUM(CASE WHEN ` + playerOwnScoreExpr + ` > ` + playerEnemyScoreExpr + ` THEN 1 ELSE 0 END)`,
+		func(a *careerAccumulator) interface{} { return &a.stats.Wins }},
+	{`SUM(CASE WHEN ` + playerOwnScoreExpr + ` < ` + playerEnemyScoreExpr + ` THEN 1 ELSE 0 END)`,
+		func(a *careerAccumulator) interface{} { return &a.stats.Losses }},
+	{`SUM(CASE WHEN ` + playerOwnScoreExpr + ` = ` + playerEnemyScoreExpr + ` THEN 1 ELSE 0 END)`,
+		func(a *careerAccumulator) interface{} { return &a.stats.Ties }},
+	{`SUM(` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.stats.Rounds }},
+
+	{`SUM(kills)`, func(a *careerAccumulator) interface{} { return &a.stats.Kills }},
+	{`SUM(deaths)`, func(a *careerAccumulator) interface{} { return &a.stats.Deaths }},
+	{`SUM(assists)`, func(a *careerAccumulator) interface{} { return &a.stats.Assists }},
+	{`SUM(opening_kills)`, func(a *careerAccumulator) interface{} { return &a.stats.OpeningKills }},
+	{`SUM(opening_deaths)`, func(a *careerAccumulator) interface{} { return &a.stats.OpeningDeaths }},
+	{`SUM(trade_kills)`, func(a *careerAccumulator) interface{} { return &a.stats.TradeKills }},
+	{`SUM(deaths_traded)`, func(a *careerAccumulator) interface{} { return &a.stats.DeathsTraded }},
+	{`SUM(clutch_attempts)`, func(a *careerAccumulator) interface{} { return &a.stats.ClutchAttempts }},
+	{`SUM(clutch_wins)`, func(a *careerAccumulator) interface{} { return &a.stats.ClutchWins }},
+	{`SUM(util_damage)`, func(a *careerAccumulator) interface{} { return &a.stats.UtilDamage }},
+	{`SUM(flash_assists)`, func(a *careerAccumulator) interface{} { return &a.stats.FlashAssists }},
+	{`SUM(enemies_flashed)`, func(a *careerAccumulator) interface{} { return &a.stats.EnemiesFlashed }},
+	{`SUM(k2)`, func(a *careerAccumulator) interface{} { return &a.stats.K2 }},
+	{`SUM(k3)`, func(a *careerAccumulator) interface{} { return &a.stats.K3 }},
+	{`SUM(k4)`, func(a *careerAccumulator) interface{} { return &a.stats.K4 }},
+	{`SUM(k5)`, func(a *careerAccumulator) interface{} { return &a.stats.K5 }},
+	{`SUM(shots_fired)`, func(a *careerAccumulator) interface{} { return &a.stats.ShotsFired }},
+	{`SUM(shots_hit)`, func(a *careerAccumulator) interface{} { return &a.stats.ShotsHit }},
+	{`SUM(first_shots_fired)`, func(a *careerAccumulator) interface{} { return &a.firstShotsFired }},
+	{`SUM(first_shots_hit)`, func(a *careerAccumulator) interface{} { return &a.firstShotsHit }},
+
+	{`SUM(adr * ` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.adrSum }},
+	{`SUM(hltv * ` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.hltvSum }},
+	{`SUM(impact * ` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.impactSum }},
+	{`SUM(kast * ` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.kastSum }},
+	{`SUM(rws * ` + matchRoundsExpr + `)`, func(a *careerAccumulator) interface{} { return &a.rwsSum }},
+	{`SUM(headshot_pct * kills)`, func(a *careerAccumulator) interface{} { return &a.headshotPctSum }},
+}
+
+// Career totals for every player in the matches that match the
+// conditions, one row per player per map. The caller fills in the
+// conditions, which can use the matches, usermeta and match_player_stats
+// tables
+func playerCareersQuery(conditions []string) string {
+	totals := make([]string, 0, len(careerTotals))
+	for _, total := range careerTotals {
+		totals = append(totals, total.expr)
+	}
+
+	return `SELECT
+		match_player_stats.steam_id,
+		` + latestPlayerNameQuery + `,
+		MAX(COALESCE(usermeta.date_override, matches.date)),
+		matches.map,
+		` + strings.Join(totals, ",\n\t\t") + `
+	FROM match_player_stats
+	JOIN matches ON matches.id = match_player_stats.match_id
+	LEFT OUTER JOIN usermeta ON mapid = matches.id
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	GROUP BY match_player_stats.steam_id, matches.map`
+}
+
+func scanPlayerCareer(row rowScanner) (PlayerMapCareer, error) {
+	var career PlayerMapCareer
+	var steamId string
+
+	dests := []interface{}{&steamId, &career.Name, &career.LastPlayed, &career.Map}
+	for _, total := range careerTotals {
+		dests = append(dests, total.dest(&career.totals))
+	}
+
+	err := row.Scan(dests...)
+	if err != nil {
+		return career, err
+	}
+
+	career.SteamId, err = strconv.ParseUint(steamId, 10, 64)
+	return career, err
+}
+
+func (a *careerAccumulator) merge(other careerAccumulator) {
+	a.stats.Matches += other.stats.Matches
+	a.stats.Wins += other.stats.Wins
+	a.stats.Losses += other.stats.Losses
+	a.stats.Ties += other.stats.Ties
+	a.stats.Rounds += other.stats.Rounds
+
+	a.stats.Kills += other.stats.Kills
+	a.stats.Deaths += other.stats.Deaths
+	a.stats.Assists += other.stats.Assists
+	a.stats.OpeningKills += other.stats.OpeningKills
+	a.stats.OpeningDeaths += other.stats.OpeningDeaths
+	a.stats.TradeKills += other.stats.TradeKills
+	a.stats.DeathsTraded += other.stats.DeathsTraded
+	a.stats.ClutchAttempts += other.stats.ClutchAttempts
+	a.stats.ClutchWins += other.stats.ClutchWins
+	a.stats.UtilDamage += other.stats.UtilDamage
+	a.stats.FlashAssists += other.stats.FlashAssists
+	a.stats.EnemiesFlashed += other.stats.EnemiesFlashed
+	a.stats.K2 += other.stats.K2
+	a.stats.K3 += other.stats.K3
+	a.stats.K4 += other.stats.K4
+	a.stats.K5 += other.stats.K5
+	a.stats.ShotsFired += other.stats.ShotsFired
+	a.stats.ShotsHit += other.stats.ShotsHit
+	a.firstShotsFired += other.firstShotsFired
+	a.firstShotsHit += other.firstShotsHit
+
+	a.adrSum += other.adrSum
+	a.hltvSum += other.hltvSum
+	a.impactSum += other.impactSum
+	a.kastSum += other.kastSum
+	a.rwsSum += other.rwsSum
+	a.headshotPctSum += other.headshotPctSum
+}
+
+func (a *careerAccumulator) finish() CareerStats {
+	ret := a.stats
+	ret.Kdiff = ret.Kills - ret.Deaths
+
+	// Unlike the per-match K/D we don't want to return infinity here since
+	// it can't be encoded as JSON
+	if ret.Deaths == 0 {
+		ret.Kd = float64(ret.Kills)
+	} else {
+		ret.Kd = round2(float64(ret.Kills) / float64(ret.Deaths))
+	}
+
+	if ret.Kills != 0 {
+		ret.HeadshotPct = math.Round(a.headshotPctSum / float64(ret.Kills))
+	}
+
+	if ret.ShotsFired != 0 {
+		ret.Accuracy = math.Round(float64(ret.ShotsHit) / float64(ret.ShotsFired) * 100)
+	}
+
+	if a.firstShotsFired != 0 {
+		ret.FirstShotAccuracy = math.Round(float64(a.firstShotsHit) / float64(a.firstShotsFired) * 100)
+	}
+
+	if ret.Rounds != 0 {
+		rounds := float64(ret.Rounds)
+		ret.Kpr = round2(float64(ret.Kills) / rounds)
+		ret.Adr = round2(a.adrSum / rounds)
+		ret.Hltv = round2(a.hltvSum / rounds)
+		ret.Impact = round2(a.impactSum / rounds)
+		ret.Kast = round2(a.kastSum / rounds)
+		ret.Rws = round2(a.rwsSum / rounds)
+	}
+
+	return ret
+}
+
+// Combine the per-map career totals into a summary for each player
+func computePlayerSummaries(careers []PlayerMapCareer) []PlayerSummary {
+	accumulators := make(map[uint64]*careerAccumulator)
+	summaries := make(map[uint64]*PlayerSummary)
+
+	for _, career := range careers {
+		summary, ok := summaries[career.SteamId]
+		if !ok {
+			summary = &PlayerSummary{SteamId: career.SteamId, Name: career.Name}
+			summaries[career.SteamId] = summary
+			accumulators[career.SteamId] = &careerAccumulator{}
+		}
+
+		if career.LastPlayed > summary.LastPlayed {
+			summary.LastPlayed = career.LastPlayed
+		}
+		accumulators[career.SteamId].merge(career.totals)
+	}
+
+	ret := make([]PlayerSummary, 0, len(summaries))
+	for player, summary := range summaries {
+		summary.Stats = accumulators[player].finish()
+		ret = append(ret, *summary)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Stats.Matches != ret[j].Stats.Matches {
+			return ret[i].Stats.Matches > ret[j].Stats.Matches
+		}
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// Build the full profile for one player from their per-map career totals,
+// their matches (newest first) and their weapon totals. Returns nil if the
+// player doesn't appear in any matches
+func computePlayerProfile(
+	careers []PlayerMapCareer,
+	matches []PlayerMatchSummary,
+	weapons map[string]WeaponStats,
+) *PlayerProfile {
+	if len(careers) == 0 {
+		return nil
+	}
+
+	summaries := computePlayerSummaries(careers)
+	profile := &PlayerProfile{PlayerSummary: summaries[0]}
+
+	profile.Maps = make(map[string]CareerStats)
+	for _, career := range careers {
+		profile.Maps[career.Map] = career.totals.finish()
+	}
+
+	profile.Weapons = finishWeaponStats(weapons)
+	profile.Matches = matches
+	return profile
+}
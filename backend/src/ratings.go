@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	InitialRating = 1000.0
+	// The most a player's rating can move in one match before the
+	// performance multiplier is applied
+	RatingKFactor = 32.0
+	// How much the player's HLTV rating scales their rating change. With
+	// 0.5 a 1.4 HLTV rating in a win gives 1.2x the gain, and in a loss
+	// 0.8x the loss
+	RatingPerformanceWeight  = 0.5
+	MinPerformanceMultiplier = 0.5
+	MaxPerformanceMultiplier = 1.5
+)
+
+// Ratings are recomputed from scratch so only one recompute can run at a
+// time, otherwise two parse workers could write over each other
+var ratingsMu sync.Mutex
+
+type RatingChange struct {
+	MatchId      string  `json:"matchId"`
+	SteamId      uint64  `json:"steamId,string"`
+	Date         int64   `json:"date"`
+	Seq          int     `json:"-"`
+	RatingBefore float64 `json:"ratingBefore"`
+	RatingAfter  float64 `json:"ratingAfter"`
+}
+
+type PlayerRating struct {
+	SteamId uint64  `json:"steamId,string"`
+	Name    string  `json:"name"`
+	Rating  float64 `json:"rating"`
+	// Number of rated matches. 0 if the player has never been rated, in
+	// which case the rating is InitialRating
+	Matches int `json:"matches"`
+}
+
+// The subset of a match needed to update ratings
+type RatingMatch struct {
+	Id         string
+	Date       int64
+	TeamAScore int
+	TeamBScore int
+	Players    []RatingPlayer
+}
+
+type RatingPlayer struct {
+	SteamId uint64
+	// CT for team A and T for team B, same as the teams map
+	Team string
+	Hltv float64
+}
+
+// Standard Elo expected score for a team rated `rating` against a team
+// rated `opponent`
+func expectedScore(rating, opponent float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponent-rating)/400))
+}
+
+func performanceMultiplier(hltv, delta float64) float64 {
+	multiplier := 1 + RatingPerformanceWeight*(hltv-1)
+	// Playing well should soften a loss, not make it worse
+	if delta < 0 {
+		multiplier = 2 - multiplier
+	}
+	return math.Max(MinPerformanceMultiplier, math.Min(MaxPerformanceMultiplier, multiplier))
+}
+
+// Run through the matches in order and work out everyone's rating before
+// and after each one. The matches must be sorted oldest first
+func computeRatings(matches []RatingMatch, useHltv bool) []RatingChange {
+	ratings := make(map[uint64]float64)
+	changes := make([]RatingChange, 0)
+
+	getRating := func(player uint64) float64 {
+		if rating, ok := ratings[player]; ok {
+			return rating
+		}
+		return InitialRating
+	}
+
+	for i, match := range matches {
+		var teamATotal, teamBTotal float64
+		var teamASize, teamBSize int
+		for _, player := range match.Players {
+			if player.Team == "CT" {
+				teamATotal += getRating(player.SteamId)
+				teamASize++
+			} else if player.Team == "T" {
+				teamBTotal += getRating(player.SteamId)
+				teamBSize++
+			}
+		}
+
+		// Can't rate a match without two teams
+		if teamASize == 0 || teamBSize == 0 {
+			continue
+		}
+
+		expectedA := expectedScore(teamATotal/float64(teamASize), teamBTotal/float64(teamBSize))
+		actualA := 0.5
+		if match.TeamAScore > match.TeamBScore {
+			actualA = 1
+		} else if match.TeamAScore < match.TeamBScore {
+			actualA = 0
+		}
+
+		teamADelta := RatingKFactor * (actualA - expectedA)
+		for _, player := range match.Players {
+			var delta float64
+			if player.Team == "CT" {
+				delta = teamADelta
+			} else if player.Team == "T" {
+				delta = -teamADelta
+			} else {
+				continue
+			}
+
+			if useHltv {
+				delta *= performanceMultiplier(player.Hltv, delta)
+			}
+
+			before := getRating(player.SteamId)
+			after := round2(before + delta)
+			ratings[player.SteamId] = after
+
+			changes = append(changes, RatingChange{
+				MatchId:      match.Id,
+				SteamId:      player.SteamId,
+				Date:         match.Date,
+				Seq:          i + 1,
+				RatingBefore: before,
+				RatingAfter:  after,
+			})
+		}
+	}
+
+	return changes
+}
+
+// Recompute every player's rating history. Errors are logged since this
+// runs as a side effect of something else (parsing, deleting a match etc)
+// which shouldn't fail because of it
+func updateRatings(trigger string, c Context) {
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+
+	c.logger.Debugf("trigger=%s recomputing player ratings", trigger)
+
+	matches, err := c.db.GetRatingMatches()
+	if err != nil {
+		c.logger.Errorf("trigger=%s failed to fetch matches for ratings: %s", trigger, err.Error())
+		return
+	}
+
+	changes := computeRatings(matches, c.config.ratingUseHltv)
+	err = c.db.ReplaceRatingHistory(changes)
+	if err != nil {
+		c.logger.Errorf("trigger=%s failed to save player ratings: %s", trigger, err.Error())
+		return
+	}
+
+	c.logger.Debugf("trigger=%s recomputed ratings from %d matches", trigger, len(matches))
+}
@@ -70,6 +70,11 @@ func route_match(c Context) func(*gin.Context) {
 		} else if retrievedMatch == nil {
 			ginc.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
 		} else {
+			meta := &retrievedMatch.Meta
+			if meta.DemoLink == "" {
+				meta.DemoLink = demoDownloadLink(c.config.demosPaths, meta.DemoRoot, meta.DemoPath)
+			}
+
 			ginc.JSON(http.StatusOK, gin.H{
 				"message": gin.H{
 					"meta":      retrievedMatch.Meta,
@@ -80,8 +85,85 @@ func route_match(c Context) func(*gin.Context) {
 	}
 }
 
+// The from and to query parameters shared by the filters. Either can be
+// left out, in which case it's 0
+func getDateRange(ginc *gin.Context) (from, to int64, err error) {
+	if fromQ := ginc.Query("from"); fromQ != "" {
+		from, err = strconv.ParseInt(fromQ, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid from date \"%s\"", fromQ)
+		}
+	}
+
+	if toQ := ginc.Query("to"); toQ != "" {
+		to, err = strconv.ParseInt(toQ, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid to date \"%s\"", toQ)
+		}
+	}
+
+	return from, to, nil
+}
+
+func getMatchFilter(ginc *gin.Context) (MatchFilter, error) {
+	filter := MatchFilter{
+		Map:      ginc.Query("map"),
+		DemoType: ginc.Query("demoType"),
+		Team:     ginc.Query("team"),
+		Sort:     ginc.DefaultQuery("sort", MatchSortDate),
+	}
+
+	var err error
+	filter.From, filter.To, err = getDateRange(ginc)
+	if err != nil {
+		return filter, err
+	}
+
+	if steamId := ginc.Query("steamId"); steamId != "" {
+		parsed, err := strconv.ParseUint(steamId, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid Steam ID \"%s\"", steamId)
+		}
+		filter.SteamId = parsed
+	}
+
+	// Scores are given as "16-14". The order doesn't matter
+	if score := ginc.Query("score"); score != "" {
+		var a, b int
+		_, err := fmt.Sscanf(score, "%d-%d", &a, &b)
+		if err != nil || a < 0 || b < 0 {
+			return filter, fmt.Errorf("invalid score \"%s\"", score)
+		}
+
+		filter.HasScore = true
+		filter.HighScore = max(a, b)
+		filter.LowScore = min(a, b)
+	}
+
+	if !isMatchSort(filter.Sort) {
+		return filter, fmt.Errorf("invalid sort \"%s\"", filter.Sort)
+	}
+
+	switch order := ginc.DefaultQuery("order", "desc"); order {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+		filter.Ascending = false
+	default:
+		return filter, fmt.Errorf("invalid sort order \"%s\"", order)
+	}
+
+	return filter, nil
+}
+
 func route_history(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
+		filter, err := getMatchFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		limitQ := ginc.DefaultQuery("limit", "50")
 		offsetQ := ginc.DefaultQuery("offset", "0")
 		limit, err := strconv.Atoi(limitQ)
@@ -94,7 +176,7 @@ func route_history(c Context) func(*gin.Context) {
 			offset = 0
 		}
 
-		matches, err := c.db.GetMatches(limit, offset)
+		matches, err := c.db.GetMatches(filter, limit, offset)
 		if err != nil {
 			errString := fmt.Sprintf("Failed to fetch matches: %s", err.Error())
 			c.logger.Errorf(errString)
@@ -107,7 +189,13 @@ func route_history(c Context) func(*gin.Context) {
 
 func route_numMatches(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
-		numMatches, err := c.db.NumMatches()
+		filter, err := getMatchFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		numMatches, err := c.db.NumMatches(filter)
 		if err != nil {
 			errString := fmt.Sprintf("Failed to fetch number of matches: %s", err.Error())
 			c.logger.Errorf(errString)
@@ -118,6 +206,395 @@ func route_numMatches(c Context) func(*gin.Context) {
 	}
 }
 
+func sendHeatmap(c Context, ginc *gin.Context, id string, filter HeatmapFilter) {
+	if strings.Contains(id, "..") || strings.Contains(id, "/") {
+		ginc.JSON(http.StatusBadRequest, gin.H{"error": "bruh"})
+		return
+	}
+
+	path, err := getOrGenHeatmap(c, id, filter)
+	if err != nil {
+		errString := fmt.Sprintf("demo=%s Failed to generate heatmap: %s", id, err.Error())
+		c.logger.Errorf(errString)
+		ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+	} else if path == "" {
+		ginc.JSON(http.StatusNotFound, gin.H{"error": "match not found"})
+	} else {
+		ginc.File(path)
+	}
+}
+
+func route_heatmap(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		filter, ok := HeatmapDataSets[ginc.Param("dataSet")]
+		if !ok {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "unknown heatmap data set"})
+			return
+		}
+
+		sendHeatmap(c, ginc, ginc.Param("id"), filter)
+	}
+}
+
+func getHeatmapFilter(ginc *gin.Context) (HeatmapFilter, error) {
+	filter := HeatmapFilter{
+		Kind: ginc.DefaultQuery("kind", PositionShot),
+		Side: ginc.Query("side"),
+	}
+
+	if !isPositionKind(filter.Kind) {
+		return filter, fmt.Errorf("invalid kind \"%s\"", filter.Kind)
+	}
+
+	if filter.Side != "" && filter.Side != "CT" && filter.Side != "T" {
+		return filter, fmt.Errorf("invalid side \"%s\"", filter.Side)
+	}
+
+	if player := ginc.Query("player"); player != "" {
+		parsed, err := strconv.ParseUint(player, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid player \"%s\"", player)
+		}
+		filter.Player = parsed
+	}
+
+	if fromRound := ginc.Query("fromRound"); fromRound != "" {
+		parsed, err := strconv.Atoi(fromRound)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("invalid fromRound \"%s\"", fromRound)
+		}
+		filter.FromRound = parsed
+	}
+
+	if toRound := ginc.Query("toRound"); toRound != "" {
+		parsed, err := strconv.Atoi(toRound)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("invalid toRound \"%s\"", toRound)
+		}
+		filter.ToRound = parsed
+	}
+
+	return filter, nil
+}
+
+func route_heatmapFilter(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		filter, err := getHeatmapFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sendHeatmap(c, ginc, ginc.Param("id"), filter)
+	}
+}
+
+func route_replay(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		round, err := strconv.Atoi(ginc.Param("n"))
+		if err != nil || round < 1 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid round number"})
+			return
+		}
+
+		frames, err := c.db.GetReplay(id, round)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"demo=%s round=%d Failed to fetch replay: %s",
+				id,
+				round,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else if frames == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "replay not found"})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": frames})
+		}
+	}
+}
+
+func route_utility(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		id := ginc.Param("id")
+		round, err := strconv.Atoi(ginc.Param("n"))
+		if err != nil || round < 1 {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid round number"})
+			return
+		}
+
+		grenades, err := c.db.GetUtility(id, round)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"demo=%s round=%d Failed to fetch utility: %s",
+				id,
+				round,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+		} else if grenades == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "utility not found"})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": grenades})
+		}
+	}
+}
+
+func getLeaderboardFilter(ginc *gin.Context) (LeaderboardFilter, error) {
+	filter := LeaderboardFilter{
+		Metric:     ginc.DefaultQuery("metric", "hltv"),
+		MinMatches: DefaultLeaderboardMinMatches,
+		Limit:      DefaultLeaderboardLimit,
+		Map:        ginc.Query("map"),
+		DemoType:   ginc.Query("demoType"),
+	}
+
+	if _, ok := LeaderboardMetrics[filter.Metric]; !ok {
+		return filter, fmt.Errorf(
+			"invalid metric \"%s\", must be one of: %s",
+			filter.Metric,
+			strings.Join(getLeaderboardMetricNames(), ", "),
+		)
+	}
+
+	if minMatches := ginc.Query("minMatches"); minMatches != "" {
+		parsed, err := strconv.Atoi(minMatches)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("invalid minimum matches \"%s\"", minMatches)
+		}
+		filter.MinMatches = parsed
+	}
+
+	if limit := ginc.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 {
+			return filter, fmt.Errorf("invalid limit \"%s\"", limit)
+		}
+		filter.Limit = min(parsed, MaxLeaderboardLimit)
+	}
+
+	var err error
+	filter.From, filter.To, err = getDateRange(ginc)
+	if err != nil {
+		return filter, err
+	}
+
+	switch order := ginc.DefaultQuery("order", "desc"); order {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+		filter.Ascending = false
+	default:
+		return filter, fmt.Errorf("invalid sort order \"%s\"", order)
+	}
+
+	return filter, nil
+}
+
+func route_leaderboard(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		filter, err := getLeaderboardFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entries, err := c.db.GetLeaderboard(filter)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch leaderboard: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		rankLeaderboard(entries)
+		ginc.JSON(http.StatusOK, gin.H{"message": Leaderboard{
+			Metric:    filter.Metric,
+			Aggregate: LeaderboardMetrics[filter.Metric].aggregate,
+			Entries:   entries,
+		}})
+	}
+}
+
+func getPlayerFilter(ginc *gin.Context) (PlayerFilter, error) {
+	filter := PlayerFilter{
+		Map:      ginc.Query("map"),
+		DemoType: ginc.Query("demoType"),
+	}
+
+	var err error
+	filter.From, filter.To, err = getDateRange(ginc)
+	if err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func route_players(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		filter, err := getPlayerFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		careers, err := c.db.GetPlayerCareers(filter)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch player careers: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": computePlayerSummaries(careers)})
+	}
+}
+
+func route_player(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		steamId, err := strconv.ParseUint(ginc.Param("steamId"), 10, 64)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid steam ID"})
+			return
+		}
+
+		filter, err := getPlayerFilter(ginc)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.SteamId = steamId
+
+		careers, err := c.db.GetPlayerCareers(filter)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"steamId=%d Failed to fetch player careers: %s",
+				steamId,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		matches, err := c.db.GetPlayerMatches(filter)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"steamId=%d Failed to fetch player matches: %s",
+				steamId,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		weapons, err := c.db.GetPlayerWeapons(filter)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"steamId=%d Failed to fetch player weapons: %s",
+				steamId,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		profile := computePlayerProfile(careers, matches, weapons)
+		if profile == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "player not found"})
+		} else {
+			ginc.JSON(http.StatusOK, gin.H{"message": profile})
+		}
+	}
+}
+
+func route_playerRatings(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		steamId, err := strconv.ParseUint(ginc.Param("steamId"), 10, 64)
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid steam ID"})
+			return
+		}
+
+		history, err := c.db.GetRatingHistory(steamId)
+		if err != nil {
+			errString := fmt.Sprintf(
+				"steamId=%d Failed to fetch rating history: %s",
+				steamId,
+				err.Error(),
+			)
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": history})
+	}
+}
+
+type BalanceInput struct {
+	SteamIds []string `json:"steamIds" binding:"required"`
+	// Optionally weigh each player's performance on a specific map,
+	// using only matches of the given demo type if set
+	Map      string `json:"map"`
+	DemoType string `json:"demoType"`
+}
+
+func route_balance(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		var input BalanceInput
+		if err := ginc.ShouldBindJSON(&input); err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		numPlayers := len(input.SteamIds)
+		if numPlayers < 2 || numPlayers > MaxBalancePlayers || numPlayers%2 != 0 {
+			ginc.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf(
+					"need an even number of players between 2 and %d",
+					MaxBalancePlayers,
+				),
+			})
+			return
+		}
+
+		steamIds := make([]uint64, 0, numPlayers)
+		seen := make(map[uint64]bool, numPlayers)
+		for _, id := range input.SteamIds {
+			steamId, err := strconv.ParseUint(id, 10, 64)
+			if err != nil {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid steam ID " + id})
+				return
+			}
+
+			if seen[steamId] {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": "duplicate steam ID " + id})
+				return
+			}
+
+			seen[steamId] = true
+			steamIds = append(steamIds, steamId)
+		}
+
+		players, err := getBalancePlayers(steamIds, input.Map, input.DemoType, c)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch player ratings: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": balanceTeams(players, NumBalanceSplits)})
+	}
+}
+
 func route_usermeta(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		id := ginc.Param("id")
@@ -20,8 +20,12 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"strconv"
@@ -59,6 +63,8 @@ func route_deleteMatch(c Context) func(*gin.Context) {
 			Description: fmt.Sprintf("Match %s was marked as deleted", id),
 		})
 
+		updateRatings("api", c)
+
 		ginc.JSON(http.StatusOK, gin.H{"message": "match deleted"})
 	}
 }
@@ -66,13 +72,36 @@ func route_deleteMatch(c Context) func(*gin.Context) {
 func route_fullDeleteMatch(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		id := ginc.Param("id")
-		err := c.db.HardDeleteMatch(id)
+		path, err := getMatchDemoPath(id, c)
 		if err != nil {
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		err = os.Remove(join(c.config.demosPath, id+".dem"))
+		// Deleting the archive would take the other matches in it with it
+		archive, _, inArchive := splitArchivePath(path)
+		if inArchive {
+			demos, err := listDemos(archive)
+			if err != nil {
+				ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if len(demos) > 1 {
+				ginc.JSON(http.StatusConflict, gin.H{
+					"error": "demo is in an archive with other demos, delete the match instead",
+				})
+				return
+			}
+		}
+
+		err = c.db.HardDeleteMatch(id)
+		if err != nil {
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = os.Remove(archive)
 		if err != nil {
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -84,6 +113,8 @@ func route_fullDeleteMatch(c Context) func(*gin.Context) {
 			Description: fmt.Sprintf("Match %s was deleted along with demo file", id),
 		})
 
+		updateRatings("api", c)
+
 		ginc.JSON(http.StatusOK, gin.H{"message": "match permanently deleted"})
 	}
 }
@@ -112,6 +143,9 @@ func route_editUserMeta(c Context) func(*gin.Context) {
 			})
 		}
 
+		// The date override changes the order the matches are rated in
+		updateRatings("api", c)
+
 		ginc.JSON(http.StatusOK, gin.H{"message": "match metadata updated"})
 	}
 }
@@ -169,6 +203,196 @@ func route_rescan(c Context) func(*gin.Context) {
 	}
 }
 
+func route_upload(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		maxBytes := int64(c.config.maxUploadSizeMb) * 1024 * 1024
+		ginc.Request.Body = http.MaxBytesReader(ginc.Writer, ginc.Request.Body, maxBytes)
+
+		reader, err := ginc.Request.MultipartReader()
+		if err != nil {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data body"})
+			return
+		}
+
+		// Skip over any other form fields until we find the demo
+		var fileName string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": "no demo file provided"})
+				return
+			} else if err != nil {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if part.FormName() != "demo" {
+				continue
+			}
+
+			fileName, err = sanitizeDemoFileName(part.FileName())
+			if err != nil {
+				ginc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			status, err := saveUploadedDemo(c, part, fileName)
+			if err != nil {
+				c.logger.Errorf("demo=%s failed to save uploaded demo: %s", fileName, err.Error())
+				ginc.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+
+			break
+		}
+
+		username := getUsername(ginc)
+		c.db.InsertAuditEntry(AuditEntry{
+			Action:      "DEMO_UPLOADED",
+			Username:    username,
+			Description: fmt.Sprintf("Demo %s was uploaded", fileName),
+		})
+
+		job, err := c.jobs.Enqueue(join(c.config.demosPaths[0], fileName), username)
+		if err != nil {
+			c.logger.Errorf("demo=%s failed to queue uploaded demo: %s", fileName, err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ginc.JSON(http.StatusAccepted, gin.H{"message": job})
+	}
+}
+
+// Stream the uploaded demo into the demos folder. Returns the HTTP status
+// code that should be sent if something goes wrong
+func saveUploadedDemo(c Context, demo io.Reader, fileName string) (int, error) {
+	// Checked again when the demo is moved into place, this just saves
+	// streaming the whole file when we already know it will be refused
+	path := join(c.config.demosPaths[0], fileName)
+	if _, err := os.Stat(path); err == nil {
+		return http.StatusConflict, errors.New("a demo with that name already exists")
+	}
+
+	conflict, err := findDemoIdConflict(getDemoId(c.config.demosPaths, path), path, c)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	} else if conflict != "" {
+		return http.StatusConflict, errors.New("a match with that name already exists")
+	}
+
+	// The demo is written under a name that the folder watcher ignores
+	// and then moved into place once it's complete. It has to be in the
+	// same folder since the data and demos folders might be on different
+	// file systems
+	tmp, err := os.CreateTemp(c.config.demosPaths[0], ".upload-*.tmp")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, demo)
+	if err != nil {
+		tmp.Close()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf(
+				"demo is larger than the %d MB limit",
+				c.config.maxUploadSizeMb,
+			)
+		}
+		return http.StatusBadRequest, err
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		tmp.Close()
+		return http.StatusInternalServerError, err
+	}
+
+	format, err := getDemoFormat(bufio.NewReader(tmp))
+	tmp.Close()
+	if err != nil || (format != DemoFormatCsgo && format != DemoFormatCs2) {
+		return http.StatusBadRequest, errors.New("file is not a CS:GO or CS2 demo")
+	}
+
+	// Unlike renaming, linking fails if the demo already exists so two
+	// uploads with the same name can't overwrite each other. The temporary
+	// file is removed by the deferred call above
+	err = os.Link(tmp.Name(), path)
+	if errors.Is(err, fs.ErrExist) {
+		return http.StatusConflict, errors.New("a demo with that name already exists")
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+func route_job(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		job, err := c.db.GetJob(ginc.Param("id"))
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch job: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		if job == nil {
+			ginc.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": job})
+	}
+}
+
+// A short-lived token for connecting to the event stream without the
+// Authorization header
+func route_eventsToken(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		username := getUsername(ginc)
+		token, err := createEventsJwt(c, username)
+		if err != nil {
+			c.logger.Errorf("username=%s failed to create event stream JWT: %s", username, err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": token})
+	}
+}
+
+// Streams server events to the client using Server-Sent Events. The
+// connection stays open until the client goes away
+func route_events(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		events := c.events.Subscribe()
+		defer c.events.Unsubscribe(events)
+
+		// Proxies like to kill connections that have been quiet for a
+		// while so send something every so often
+		keepAlive := time.NewTicker(EventKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		ginc.Header("Cache-Control", "no-cache")
+		ginc.Header("X-Accel-Buffering", "no")
+
+		ginc.Stream(func(w io.Writer) bool {
+			select {
+			case event := <-events:
+				ginc.SSEvent(event.Type, event)
+			case <-keepAlive.C:
+				ginc.SSEvent("ping", ServerEvent{Type: "ping", Timestamp: time.Now().UnixMilli()})
+			case <-ginc.Request.Context().Done():
+				return false
+			}
+			return true
+		})
+	}
+}
+
 func route_userinfo(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		userVal, exists := ginc.Get("user")
@@ -251,6 +475,38 @@ func route_auditLog(c Context) func(*gin.Context) {
 	}
 }
 
+func route_jobs(c Context) func(*gin.Context) {
+	return func(ginc *gin.Context) {
+		limitQ := ginc.DefaultQuery("limit", "50")
+		offsetQ := ginc.DefaultQuery("offset", "0")
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil {
+			limit = 50
+		}
+
+		offset, err := strconv.Atoi(offsetQ)
+		if err != nil {
+			offset = 0
+		}
+
+		status := ginc.Query("status")
+		if status != "" && !isJobStatus(status) {
+			ginc.JSON(http.StatusBadRequest, gin.H{"error": "invalid job status"})
+			return
+		}
+
+		jobs, err := c.db.GetJobs(status, limit, offset)
+		if err != nil {
+			errString := fmt.Sprintf("Failed to fetch jobs: %s", err.Error())
+			c.logger.Errorf(errString)
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": errString})
+			return
+		}
+
+		ginc.JSON(http.StatusOK, gin.H{"message": jobs})
+	}
+}
+
 func route_numAuditLogEntries(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		numEntries, err := c.db.NumAuditLogEntries()
@@ -333,13 +589,20 @@ func route_logout(c Context) func(*gin.Context) {
 func route_restore(c Context) func(*gin.Context) {
 	return func(ginc *gin.Context) {
 		id := ginc.Param("id")
-		path := join(c.config.demosPath, id+".dem")
-		err := parseIdempotent(path, c.config.dataPath, true, c)
+		path, err := getMatchDemoPath(id, c)
+		if err != nil {
+			c.logger.Errorf("failed to find demo during restore: %s", err.Error())
+			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = parseIdempotent(path, join(c.config.dataPath, "heatmaps"), true, c)
 		if err != nil {
 			c.logger.Errorf("failed to parse match during restore: %s", err.Error())
 			ginc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		} else {
+			updateRatings("api", c)
 			ginc.JSON(http.StatusOK, gin.H{"message": "match restored"})
 		}
 	}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -31,12 +32,19 @@ import (
 
 func doRescan(trigger string, c Context) {
 	c.logger.Infof("trigger=%s starting incremental demo folder rescan", trigger)
+	c.events.Publish(ServerEvent{Type: EventRescanStarted, Trigger: trigger})
 
-	err := parseAllIdempotent(c.config.demosPath, c.config.dataPath, c)
+	err := queueAllDemos(c.config.demosPaths, c.config.dataPath, c)
 	if err != nil {
 		c.logger.Errorf("trigger=%s failed to re-scan demos folder: %s", trigger, err.Error())
+		c.events.Publish(ServerEvent{
+			Type:    EventRescanFinished,
+			Trigger: trigger,
+			Error:   err.Error(),
+		})
 	} else {
 		c.logger.Infof("trigger=%s incremental demo folder rescan finished", trigger)
+		c.events.Publish(ServerEvent{Type: EventRescanFinished, Trigger: trigger})
 	}
 }
 
@@ -47,46 +55,152 @@ func watchFileChanges(c Context) {
 
 	// register our fsnotify watcher to send events to our
 	// fileChanged channel
-	go watchDemoDir(c.config.demosPath, fileCreated, fileRenamed, c.logger)
+	go watchDemoDirs(c.config.demosPaths, fileCreated, fileRenamed, c.logger)
 
 	for {
 		select {
 		case created := <-fileCreated:
 			c.logger.Infof("new file detected: %s", created)
-			demoId := getDemoFileName(created)
-			err := parseIdempotent(created, heatmapsDir, false, c)
-			if err != nil {
-				c.logger.Errorf(
-					"demo=%s Failed to parse demo: %s",
-					demoId,
-					err.Error(),
-				)
-			} else {
-				c.logger.Infof("demo=%s added demo to database", demoId)
+
+			sources := []string{created}
+			if isDir(created) {
+				var err error
+				sources, err = findDemoSources(created)
+				if err != nil {
+					c.logger.Errorf("failed to read demo folder %s: %s", created, err.Error())
+					continue
+				}
+			}
+
+			for _, source := range sources {
+				// Each demo in an archive is its own match
+				demos, err := listDemos(source)
+				if err != nil {
+					c.logger.Errorf("failed to read demo archive %s: %s", source, err.Error())
+					continue
+				}
+
+				for _, demo := range demos {
+					queueNewDemo(demo, c)
+				}
 			}
 		case renamed := <-fileRenamed:
 			c.logger.Infof("rename detected: %s -> %s", renamed.old, renamed.new)
-			oldId := getDemoFileName(renamed.old)
-			newId := getDemoFileName(renamed.new)
+			for _, demo := range renamedDemos(renamed, c) {
+				renameDemo(demo, heatmapsDir, c)
+			}
+		}
+	}
+}
+
+func queueNewDemo(demo string, c Context) {
+	demoId := getDemoId(c.config.demosPaths, demo)
+	c.events.Publish(ServerEvent{
+		Type:   EventDemoDiscovered,
+		DemoId: demoId,
+	})
+
+	job, err := c.jobs.Enqueue(demo, "")
+	if err != nil {
+		c.logger.Errorf(
+			"demo=%s Failed to queue demo for parsing: %s",
+			demoId,
+			err.Error(),
+		)
+	} else {
+		c.logger.Infof("job=%s demo=%s queued demo for parsing", job.Id, job.DemoId)
+	}
+}
 
-			c.db.InsertAuditEntry(AuditEntry{
-				System:      true,
-				Action:      "MATCH_RENAMED",
-				Description: fmt.Sprintf("Match %s was renamed to %s", oldId, newId),
+// The old and new paths of every demo affected by the rename. That's all
+// of the demos inside it for folders and archives
+func renamedDemos(renamed FileRename, c Context) []FileRename {
+	sources := []FileRename{renamed}
+	if isDir(renamed.new) {
+		newSources, err := findDemoSources(renamed.new)
+		if err != nil {
+			c.logger.Errorf("failed to read demo folder %s: %s", renamed.new, err.Error())
+			return nil
+		}
+
+		sources = make([]FileRename, 0, len(newSources))
+		for _, source := range newSources {
+			sources = append(sources, FileRename{
+				old: renamed.old + strings.TrimPrefix(source, renamed.new),
+				new: source,
 			})
+		}
+	}
 
-			err := c.db.RenameMatch(oldId, newId)
-			if err != nil {
-				c.logger.Errorf(
-					"demo=%s newName=%s failed to rename demo: %s",
-					oldId,
-					newId,
-					err.Error(),
-				)
-			} else {
-				c.logger.Infof("demo=%s newName=%s renamed demo", oldId, newId)
-			}
+	var demos []FileRename
+	for _, source := range sources {
+		newDemos, err := listDemos(source.new)
+		if err != nil {
+			c.logger.Errorf("failed to read demo archive %s: %s", source.new, err.Error())
+			continue
+		}
+
+		for _, demo := range newDemos {
+			demos = append(demos, FileRename{
+				old: source.old + strings.TrimPrefix(demo, source.new),
+				new: demo,
+			})
+		}
+	}
+
+	return demos
+}
+
+func renameDemo(renamed FileRename, heatmapsDir string, c Context) {
+	oldId := getDemoId(c.config.demosPaths, renamed.old)
+	newId := getDemoId(c.config.demosPaths, renamed.new)
+	newRoot, newPath, _ := locateDemo(c.config.demosPaths, renamed.new)
+
+	// The match and its heatmaps only need renaming if the ID changed
+	if oldId != newId {
+		c.db.InsertAuditEntry(AuditEntry{
+			System:      true,
+			Action:      "MATCH_RENAMED",
+			Description: fmt.Sprintf("Match %s was renamed to %s", oldId, newId),
+		})
+
+		err := c.db.RenameMatch(oldId, newId)
+		if err != nil {
+			c.logger.Errorf(
+				"demo=%s newName=%s failed to rename demo: %s",
+				oldId,
+				newId,
+				err.Error(),
+			)
+			return
 		}
+
+		err = renameHeatmaps(heatmapsDir, oldId, newId)
+		if err != nil {
+			c.logger.Errorf(
+				"demo=%s newName=%s failed to rename heatmaps: %s",
+				oldId,
+				newId,
+				err.Error(),
+			)
+		}
+
+		c.logger.Infof("demo=%s newName=%s renamed demo", oldId, newId)
+		c.events.Publish(ServerEvent{
+			Type:      EventDemoRenamed,
+			DemoId:    oldId,
+			NewDemoId: newId,
+		})
+	}
+
+	err := c.db.UpdateDemoPath(newId, newRoot, newPath)
+	if err != nil {
+		c.logger.Errorf(
+			"demo=%s newName=%s failed to update demo path: %s",
+			newId,
+			newPath,
+			err.Error(),
+		)
 	}
 }
 
@@ -109,6 +223,20 @@ func registerJobs(s *gocron.Scheduler, c Context) {
 			c.logger.Infof("trigger=cron finished clearing stale invalid tokens")
 		}
 	})
+
+	s.Every(1).Hour().Do(func() {
+		c.logger.Infof("trigger=cron clearing finished parse jobs")
+		cutoff := time.Now().Add(-JobRetentionHours * time.Hour).UnixMilli()
+		err := c.db.CleanFinishedJobs(cutoff)
+		if err != nil {
+			c.logger.Errorf(
+				"trigger=cron failed to clean finished parse jobs from database: %s",
+				err.Error(),
+			)
+		} else {
+			c.logger.Infof("trigger=cron finished clearing finished parse jobs")
+		}
+	})
 }
 
 func genFileRoute(router *gin.Engine, maxAge int, basepath ...string) func(string) {
@@ -145,7 +273,12 @@ func runServer(c Context) {
 	assetRoute := genFileRoute(r, 259200, c.config.assetsPath, "..")
 
 	// Middlewares
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// The event stream has to be flushed as it's written which doesn't
+	// play nicely with the gzip writer
+	r.Use(gzip.Gzip(
+		gzip.DefaultCompression,
+		gzip.WithExcludedPaths([]string{"/api/v1/events"}),
+	))
 
 	// Static files in the root that browsers might ask for
 	staticFileRoute("/android-chrome-192x192.png")
@@ -181,6 +314,26 @@ func runServer(c Context) {
 	assetRoute("/assets/maps/de_overpass.jpg")
 	assetRoute("/assets/maps/de_train.jpg")
 	assetRoute("/assets/maps/de_vertigo.jpg")
+	assetRoute("/assets/minimaps/de_ancient.jpg")
+	assetRoute("/assets/minimaps/de_cache.jpg")
+	assetRoute("/assets/minimaps/de_canals.jpg")
+	assetRoute("/assets/minimaps/de_cbble.jpg")
+	assetRoute("/assets/minimaps/de_dust.jpg")
+	assetRoute("/assets/minimaps/de_dust2.jpg")
+	assetRoute("/assets/minimaps/de_inferno.jpg")
+	assetRoute("/assets/minimaps/de_lake.jpg")
+	assetRoute("/assets/minimaps/de_mirage.jpg")
+	assetRoute("/assets/minimaps/de_nuke.jpg")
+	assetRoute("/assets/minimaps/de_nuke_lower.jpg")
+	assetRoute("/assets/minimaps/de_overpass.jpg")
+	assetRoute("/assets/minimaps/de_santorini.jpg")
+	assetRoute("/assets/minimaps/de_season.jpg")
+	assetRoute("/assets/minimaps/de_shortdust.jpg")
+	assetRoute("/assets/minimaps/de_shortnuke.jpg")
+	assetRoute("/assets/minimaps/de_shorttrain.jpg")
+	assetRoute("/assets/minimaps/de_train.jpg")
+	assetRoute("/assets/minimaps/de_vertigo.jpg")
+	assetRoute("/assets/minimaps/de_vertigo_lower.jpg")
 	assetRoute("/assets/weapons/eq_fraggrenade.png")
 	assetRoute("/assets/weapons/eq_taser.png")
 	assetRoute("/assets/weapons/fire.png")
@@ -238,8 +391,17 @@ func runServer(c Context) {
 
 		if c.config.matchVisibility == "public" {
 			v1.GET("/matches/:id", route_match(c))
+			v1.GET("/matches/:id/heatmaps/:dataSet", route_heatmap(c))
+			v1.GET("/matches/:id/heatmap", route_heatmapFilter(c))
+			v1.GET("/matches/:id/rounds/:n/replay", route_replay(c))
+			v1.GET("/matches/:id/rounds/:n/utility", route_utility(c))
 			v1.GET("/history", route_history(c))
 			v1.GET("/numMatches", route_numMatches(c))
+			v1.GET("/players", route_players(c))
+			v1.GET("/players/:steamId", route_player(c))
+			v1.GET("/players/:steamId/ratings", route_playerRatings(c))
+			v1.GET("/leaderboards", route_leaderboard(c))
+			v1.POST("/balance", route_balance(c))
 		}
 
 		v1.GET("/usermeta/:id", route_usermeta(c))
@@ -251,9 +413,13 @@ func runServer(c Context) {
 		}
 
 		if c.config.allowDemoDownload {
-			v1.Static("/demos", c.config.demosPath)
+			for i, demosPath := range c.config.demosPaths {
+				v1.Static(demoDownloadRoute(i), demosPath)
+			}
 		}
 
+		v1.GET("/events", StreamAuthRequired(c), route_events(c))
+
 		v1Auth := v1.Group("/")
 		v1Auth.Use(AuthRequired(c))
 		{
@@ -264,11 +430,23 @@ func runServer(c Context) {
 			v1Auth.POST("/logout", route_logout(c))
 
 			v1Auth.PATCH("/rescan", route_rescan(c))
+			v1Auth.POST("/upload", route_upload(c))
+			v1Auth.GET("/jobs/:id", route_job(c))
+			v1Auth.POST("/events/token", route_eventsToken(c))
 
 			if c.config.matchVisibility == "private" {
 				v1Auth.GET("/matches/:id", route_match(c))
+				v1Auth.GET("/matches/:id/heatmaps/:dataSet", route_heatmap(c))
+				v1Auth.GET("/matches/:id/heatmap", route_heatmapFilter(c))
+				v1Auth.GET("/matches/:id/rounds/:n/replay", route_replay(c))
+				v1Auth.GET("/matches/:id/rounds/:n/utility", route_utility(c))
 				v1Auth.GET("/history", route_history(c))
 				v1Auth.GET("/numMatches", route_numMatches(c))
+				v1Auth.GET("/players", route_players(c))
+				v1Auth.GET("/players/:steamId", route_player(c))
+				v1Auth.GET("/players/:steamId/ratings", route_playerRatings(c))
+				v1Auth.GET("/leaderboards", route_leaderboard(c))
+				v1Auth.POST("/balance", route_balance(c))
 			}
 		}
 
@@ -284,6 +462,7 @@ func runServer(c Context) {
 			v1Admin.GET("/deletedMatches", route_deletedMatches(c))
 			v1Admin.GET("/audit", route_auditLog(c))
 			v1Admin.GET("/auditsize", route_numAuditLogEntries(c))
+			v1Admin.GET("/jobs", route_jobs(c))
 
 			v1Admin.POST("/adminregister", route_register(c))
 			v1Admin.PUT("/usermeta/:id", route_editUserMeta(c))
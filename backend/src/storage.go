@@ -19,7 +19,13 @@
 
 package main
 
-import "time"
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type RetrievedMeta struct {
 	DemoLink string `json:"demoLink"`
@@ -36,9 +42,23 @@ type Storage interface {
 	InsertAuditEntry(entry AuditEntry) error
 	UpsertMatches(match ...Match) error
 	UpsertMatchMeta(id string, meta UserMeta) error
+	// Replace the stored replay frames for a match. replays[i] is round i+1
+	UpsertReplays(id string, replays [][]ReplayFrame) error
+	// Replace the stored grenades for a match. utility[i] is round i+1
+	UpsertUtility(id string, utility [][]Grenade) error
+	// Replace the entire rating history with the given changes
+	ReplaceRatingHistory(changes []RatingChange) error
 	// Change the ID of a match (if the demo is renamed in the folder)
 	RenameMatch(oldId, newId string) error
+	// Update where the match's demo is after it was moved. The path is
+	// relative to the demo folder at index root
+	UpdateDemoPath(id string, root int, path string) error
+	// Change the parsed date of a match. Date overrides aren't affected
+	UpdateMatchDate(date MatchDate) error
 	UpdateUser(username string, newInfo UserWithPassword) error
+	InsertJob(job Job) error
+	// Update the status, error and attempt count of the job
+	UpdateJob(job Job) error
 
 	// Returns if the match exists, and if so which parser version was used
 	// to parse it
@@ -46,19 +66,64 @@ type Storage interface {
 	HasUser(username string) (bool, error)
 
 	NumUsers() (int, error)
-	NumMatches() (int, error)
+	// Count the non-deleted matches that match the filter
+	NumMatches(filter MatchFilter) (int, error)
 	NumAuditLogEntries() (int, error)
 
 	GetMatch(id string) (*RetrievedMatch, error)
 	// Fetch match metadatas (match history) from the database
-	GetMatches(limit, offset int) ([]MetaData, error)
+	GetMatches(filter MatchFilter, limit, offset int) ([]MetaData, error)
+	// Fetch the parsed date of every match, including deleted ones
+	GetMatchDates() ([]MatchDate, error)
+	// Fetch the index of the demo folder the match was parsed from and the
+	// path of the demo relative to it. Deleted matches are included.
+	// Returns a path of "" if the match doesn't exist
+	GetDemoPath(id string) (int, string, error)
 	// Fetch matches which are marked as deleted
 	GetDeletedMatches(limit, offset int) ([]MetaData, error)
+	// Fetch the career totals of every player in the non-deleted matches
+	// that match the filter, per map. Only the given player is included if
+	// the filter has a steam ID
+	GetPlayerCareers(filter PlayerFilter) ([]PlayerMapCareer, error)
+	// Fetch the non-deleted matches that the filter's player was in that
+	// match the filter, newest first
+	GetPlayerMatches(filter PlayerFilter) ([]PlayerMatchSummary, error)
+	// Fetch the weapon totals of the filter's player over the non-deleted
+	// matches that match the filter, keyed by weapon
+	GetPlayerWeapons(filter PlayerFilter) (map[string]WeaponStats, error)
+	// Rank players by one of the LeaderboardMetrics. Ranks aren't filled
+	// in, the entries are just returned in order
+	GetLeaderboard(filter LeaderboardFilter) ([]LeaderboardEntry, error)
+	// Fetch every non-deleted match along with its players, oldest first
+	GetRatingMatches() ([]RatingMatch, error)
+	// Fetch the rating changes for the given player, oldest first
+	GetRatingHistory(steamId uint64) ([]RatingChange, error)
+	// Fetch the current rating of each of the given players. Players that
+	// have never been rated are left out
+	GetRatings(steamIds []uint64) ([]PlayerRating, error)
+	// Fetch the position events for the given match. Returns nil if the
+	// match doesn't exist
+	GetMatchPositions(id string) ([]PositionEvent, error)
+	// Fetch the replay frames for one round of a match. Returns nil if
+	// the match or round doesn't exist
+	GetReplay(id string, round int) ([]ReplayFrame, error)
+	GetUtility(id string, round int) ([]Grenade, error)
 	// Fetch user-defined data for the given match
 	GetUserMeta(id string) (*UserMeta, error)
 	GetUser(username string) (*User, error)
 	GetUsers() ([]User, error)
 	GetAuditLog(limit, offset int) ([]AuditEntry, error)
+	// Returns nil if the job doesn't exist
+	GetJob(id string) (*Job, error)
+	// Fetch parse jobs, newest first. If status is empty jobs with any
+	// status are returned
+	GetJobs(status string, limit, offset int) ([]Job, error)
+	// Fetch the most recent job for the given demo path. Returns nil if
+	// the demo has never been queued
+	GetLatestJob(path string) (*Job, error)
+	// Mark the oldest queued job as running and return it. Returns nil if
+	// there are no queued jobs
+	ClaimJob() (*Job, error)
 
 	// Validate the username and password & return the user if valid
 	Login(username, password string) (*User, error)
@@ -70,6 +135,11 @@ type Storage interface {
 	IsTokenValid(token string) (bool, error)
 	// Remove tokens from the invalided tokens table that have expired
 	CleanInvalidTokens() error
+	// Put jobs that were running when the server stopped back in the queue
+	RequeueRunningJobs() error
+	// Remove finished jobs that were last updated before the given time
+	// (unix millis)
+	CleanFinishedJobs(before int64) error
 
 	// Run database schema migrations in the up or down direction
 	RunMigration(config Config, dir string) error
@@ -84,3 +154,325 @@ type Storage interface {
 	// Close the database pool connection
 	Close()
 }
+
+// The columns are all from the matches table (or the date alias) so it's
+// safe to put them straight into the query
+var matchSortColumns = map[string]string{
+	MatchSortDate:   "date",
+	MatchSortMap:    "map",
+	MatchSortRounds: "team_a_score + team_b_score",
+}
+
+func isMatchSort(sort string) bool {
+	_, ok := matchSortColumns[sort]
+	return ok
+}
+
+func matchOrderBy(filter MatchFilter) string {
+	column, ok := matchSortColumns[filter.Sort]
+	if !ok {
+		column = matchSortColumns[MatchSortDate]
+	}
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+
+	// The ID keeps the order stable between pages when the sort column
+	// has duplicates
+	return "ORDER BY " + column + " " + direction + ", id " + direction
+}
+
+type playerStatColumn struct {
+	name  string
+	field int
+}
+
+// The stat columns in match_player_stats. These come from the db tags on
+// the Stats struct so that adding a stat only needs a migration
+var playerStatColumns = getPlayerStatColumns()
+
+func getPlayerStatColumns() []playerStatColumn {
+	t := reflect.TypeOf(Stats{})
+	columns := make([]playerStatColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("db"); name != "" {
+			columns = append(columns, playerStatColumn{name: name, field: i})
+		}
+	}
+	return columns
+}
+
+// All of the columns in match_player_stats, in the same order as the
+// values returned by getPlayerStatRows
+func getPlayerStatInsertColumns() []string {
+	columns := []string{"match_id", "steam_id", "name", "team", "start_side"}
+	for _, column := range playerStatColumns {
+		columns = append(columns, column.name)
+	}
+	return columns
+}
+
+// One row of match_player_stats values for each player in the match
+func getPlayerStatRows(match Match) [][]interface{} {
+	players := make([]uint64, 0, len(match.MatchData.Teams))
+	for player := range match.MatchData.Teams {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i] < players[j] })
+
+	stats := reflect.ValueOf(match.MatchData.Stats)
+	rows := make([][]interface{}, 0, len(players))
+
+	for _, player := range players {
+		row := []interface{}{
+			match.Meta.Id,
+			strconv.FormatUint(player, 10),
+			match.Meta.PlayerNames[player],
+			match.MatchData.Teams[player],
+			match.MatchData.StartTeams[player],
+		}
+
+		for _, column := range playerStatColumns {
+			statMap := stats.Field(column.field)
+			value := statMap.MapIndex(reflect.ValueOf(player))
+			if !value.IsValid() {
+				value = reflect.Zero(statMap.Type().Elem())
+			}
+			row = append(row, value.Interface())
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// The columns in match_player_weapons, in the same order as the values
+// returned by getPlayerWeaponRows
+var playerWeaponColumns = []string{
+	"match_id",
+	"steam_id",
+	"weapon",
+	"kills",
+	"headshots",
+	"damage",
+	"shots",
+	"hits",
+	"first_shots",
+	"first_shot_hits",
+	"head_hits",
+	"chest_hits",
+	"stomach_hits",
+	"arm_hits",
+	"leg_hits",
+}
+
+// One row of match_player_weapons values for each weapon each player used
+// in the match
+func getPlayerWeaponRows(match Match) [][]interface{} {
+	players := make([]uint64, 0, len(match.MatchData.Stats.Weapons))
+	for player := range match.MatchData.Stats.Weapons {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i] < players[j] })
+
+	rows := make([][]interface{}, 0)
+	for _, player := range players {
+		weapons := make([]string, 0, len(match.MatchData.Stats.Weapons[player]))
+		for weapon := range match.MatchData.Stats.Weapons[player] {
+			weapons = append(weapons, weapon)
+		}
+		sort.Strings(weapons)
+
+		for _, weapon := range weapons {
+			stats := match.MatchData.Stats.Weapons[player][weapon]
+			rows = append(rows, []interface{}{
+				match.Meta.Id,
+				strconv.FormatUint(player, 10),
+				weapon,
+				stats.Kills,
+				stats.Headshots,
+				stats.Damage,
+				stats.Shots,
+				stats.Hits,
+				stats.FirstShots,
+				stats.FirstShotHits,
+				stats.HeadHits,
+				stats.ChestHits,
+				stats.StomachHits,
+				stats.ArmHits,
+				stats.LegHits,
+			})
+		}
+	}
+
+	return rows
+}
+
+// A player's weapon totals over the matches that match the conditions.
+// The caller fills in the conditions, which can use the matches, usermeta
+// and match_player_weapons tables
+func playerWeaponsQuery(conditions []string) string {
+	return `SELECT
+		weapon,
+		SUM(kills),
+		SUM(headshots),
+		SUM(damage),
+		SUM(shots),
+		SUM(hits),
+		SUM(first_shots),
+		SUM(first_shot_hits),
+		SUM(head_hits),
+		SUM(chest_hits),
+		SUM(stomach_hits),
+		SUM(arm_hits),
+		SUM(leg_hits)
+	FROM match_player_weapons
+	JOIN matches ON matches.id = match_player_weapons.match_id
+	LEFT OUTER JOIN usermeta ON mapid = matches.id
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	GROUP BY weapon`
+}
+
+func scanPlayerWeapon(row rowScanner) (string, WeaponStats, error) {
+	var weapon string
+	var stats WeaponStats
+	err := row.Scan(
+		&weapon,
+		&stats.Kills,
+		&stats.Headshots,
+		&stats.Damage,
+		&stats.Shots,
+		&stats.Hits,
+		&stats.FirstShots,
+		&stats.FirstShotHits,
+		&stats.HeadHits,
+		&stats.ChestHits,
+		&stats.StomachHits,
+		&stats.ArmHits,
+		&stats.LegHits,
+	)
+	return weapon, stats, err
+}
+
+// The most recent name the player used. Expects to be used in a query
+// grouped by match_player_stats.steam_id
+const latestPlayerNameQuery = `(
+	SELECT latest.name
+	FROM match_player_stats AS latest
+	JOIN matches AS latest_match ON latest_match.id = latest.match_id
+	WHERE latest.steam_id = match_player_stats.steam_id
+	ORDER BY latest_match.date DESC
+	LIMIT 1
+)`
+
+const ratingMatchesQuery = `SELECT
+	matches.id,
+	COALESCE(usermeta.date_override, matches.date) AS date,
+	matches.team_a_score,
+	matches.team_b_score,
+	match_player_stats.steam_id,
+	match_player_stats.team,
+	match_player_stats.hltv
+FROM matches
+JOIN match_player_stats ON match_player_stats.match_id = matches.id
+LEFT OUTER JOIN usermeta ON mapid = matches.id
+WHERE deleted = FALSE
+ORDER BY date, matches.id, match_player_stats.steam_id`
+
+// Scan one row of the ratingMatchesQuery. There's one row per player so
+// rows from the same match are grouped together
+func scanRatingMatch(row rowScanner, matches []RatingMatch) ([]RatingMatch, error) {
+	var id, steamIdString, team string
+	var date int64
+	var teamAScore, teamBScore int
+	var hltv float64
+
+	err := row.Scan(&id, &date, &teamAScore, &teamBScore, &steamIdString, &team, &hltv)
+	if err != nil {
+		return nil, err
+	}
+
+	steamId, err := strconv.ParseUint(steamIdString, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 || matches[len(matches)-1].Id != id {
+		matches = append(matches, RatingMatch{
+			Id:         id,
+			Date:       date,
+			TeamAScore: teamAScore,
+			TeamBScore: teamBScore,
+		})
+	}
+
+	match := &matches[len(matches)-1]
+	match.Players = append(match.Players, RatingPlayer{SteamId: steamId, Team: team, Hltv: hltv})
+	return matches, nil
+}
+
+// The latest rating for each player, their name as of that match and the
+// number of rated matches. The caller fills in the steam ID condition
+const ratingsQuery = `SELECT
+	rating.steam_id,
+	COALESCE((
+		SELECT name FROM match_player_stats
+		WHERE match_id = rating.match_id AND steam_id = rating.steam_id
+	), ''),
+	rating.rating_after,
+	(SELECT COUNT(*) FROM rating_history WHERE steam_id = rating.steam_id)
+FROM rating_history AS rating
+WHERE rating.seq = (
+	SELECT MAX(seq) FROM rating_history WHERE steam_id = rating.steam_id
+)`
+
+func scanPlayerRating(row rowScanner) (PlayerRating, error) {
+	var rating PlayerRating
+	var steamId string
+
+	err := row.Scan(&steamId, &rating.Name, &rating.Rating, &rating.Matches)
+	if err != nil {
+		return PlayerRating{}, err
+	}
+
+	rating.SteamId, err = strconv.ParseUint(steamId, 10, 64)
+	return rating, err
+}
+
+const jobColumns = `id, demo_id, path, status, error, attempts, username, created_at, updated_at, retry_at`
+
+// Implemented by the row types of both database drivers
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scan a row containing the jobColumns into a Job
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	var username *string
+
+	err := row.Scan(
+		&job.Id,
+		&job.DemoId,
+		&job.Path,
+		&job.Status,
+		&job.Error,
+		&job.Attempts,
+		&username,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.RetryAt,
+	)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if username != nil {
+		job.Username = *username
+	}
+
+	return job, nil
+}
@@ -170,6 +170,11 @@ func (p *pgdb) genMatchInsert(match Match, base int, params *[]interface{}) (str
 		return "", err
 	}
 
+	positions, err := json.Marshal(match.Positions)
+	if err != nil {
+		return "", err
+	}
+
 	sql := valuesRowSql(base, MatchInsertNumFields)
 	*params = append(*params,
 		match.Meta.Id,
@@ -177,32 +182,90 @@ func (p *pgdb) genMatchInsert(match Match, base int, params *[]interface{}) (str
 		false,
 		match.Meta.Map,
 		match.Meta.DateTimestamp,
+		match.Meta.DateSource,
 		match.Meta.DemoType,
+		match.Meta.DemoTypeConfidence,
 		string(player_names),
 		match.Meta.TeamAScore,
 		match.Meta.TeamBScore,
 		match.Meta.TeamATitle,
 		match.Meta.TeamBTitle,
 		string(match_data),
+		string(positions),
+		match.Meta.DemoRoot,
+		match.Meta.DemoPath,
 	)
 
 	return sql, nil
 }
 
-func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
+// Build the WHERE conditions for the filter. The placeholders start at
+// len(args)+1 so the caller can add its own arguments first
+func (p *pgdb) matchConditions(filter MatchFilter, args []interface{}) ([]string, []interface{}) {
+	conditions := make([]string, 0)
+	placeholder := func(arg interface{}) string {
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.SteamId != 0 {
+		// uses the GIN index on player_names
+		conditions = append(conditions,
+			`player_names ? `+placeholder(strconv.FormatUint(filter.SteamId, 10)))
+	}
+
+	if filter.From != 0 {
+		conditions = append(conditions,
+			`COALESCE(usermeta.date_override, matches.date) >= `+placeholder(filter.From))
+	}
+
+	if filter.To != 0 {
+		conditions = append(conditions,
+			`COALESCE(usermeta.date_override, matches.date) <= `+placeholder(filter.To))
+	}
+
+	if filter.Map != "" {
+		conditions = append(conditions, `map = `+placeholder(filter.Map))
+	}
+
+	if filter.DemoType != "" {
+		conditions = append(conditions, `demo_type = `+placeholder(filter.DemoType))
+	}
+
+	if filter.Team != "" {
+		team := placeholder(strings.ToLower(filter.Team))
+		conditions = append(conditions,
+			`(LOWER(team_a_title) = `+team+` OR LOWER(team_b_title) = `+team+`)`)
+	}
+
+	if filter.HasScore {
+		conditions = append(conditions,
+			`GREATEST(team_a_score, team_b_score) = `+placeholder(filter.HighScore),
+			`LEAST(team_a_score, team_b_score) = `+placeholder(filter.LowScore))
+	}
+
+	return conditions, args
+}
+
+func (p *pgdb) getMatches(filter MatchFilter, limit, offset int, deleted bool) ([]MetaData, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Release()
 
+	conditions, args := p.matchConditions(filter, []interface{}{deleted, limit, offset})
+	conditions = append([]string{`deleted = $1`}, conditions...)
+
 	rows, err := conn.
 		Query(context.Background(),
 			`SELECT
 			   id,
 			   map,
 			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
 			   demo_type,
+			   demo_type_confidence,
 			   player_names,
 			   team_a_score,
 			   team_b_score,
@@ -210,19 +273,26 @@ func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
 			   team_b_title
 			 FROM matches
 			 LEFT OUTER JOIN usermeta ON mapid = id
-			 WHERE deleted = $1
-			 ORDER BY date DESC
-			 LIMIT $2 OFFSET $3`, deleted, limit, offset)
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 `+matchOrderBy(filter)+`
+			 LIMIT $2 OFFSET $3`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	matches := make([]MetaData, 0, 10)
 	for rows.Next() {
 		var id, mapName, demoType, teamATitle, teamBTitle string
 		var dateTimestamp int64
+		var demoTypeConfidence float64
+		var dateSource string
 		var teamAScore, teamBScore int
 		var playerNames NamesMap
 
 		err = rows.Scan(
-			&id, &mapName, &dateTimestamp, &demoType, &playerNames,
+			&id, &mapName, &dateTimestamp, &dateSource, &demoType, &demoTypeConfidence, &playerNames,
 			&teamAScore, &teamBScore, &teamATitle, &teamBTitle,
 		)
 
@@ -232,15 +302,17 @@ func (p *pgdb) getMatches(limit, offset int, deleted bool) ([]MetaData, error) {
 
 		matches = append(matches,
 			MetaData{
-				Map:           mapName,
-				Id:            id,
-				DateTimestamp: dateTimestamp,
-				DemoType:      demoType,
-				PlayerNames:   playerNames,
-				TeamAScore:    teamAScore,
-				TeamBScore:    teamBScore,
-				TeamATitle:    teamATitle,
-				TeamBTitle:    teamBTitle,
+				Map:                mapName,
+				Id:                 id,
+				DateTimestamp:      dateTimestamp,
+				DateSource:         dateSource,
+				DemoType:           demoType,
+				DemoTypeConfidence: demoTypeConfidence,
+				PlayerNames:        playerNames,
+				TeamAScore:         teamAScore,
+				TeamBScore:         teamBScore,
+				TeamATitle:         teamATitle,
+				TeamBTitle:         teamBTitle,
 			})
 	}
 
@@ -305,7 +377,54 @@ func (p *pgdb) InsertAuditEntry(entry AuditEntry) error {
 	return err
 }
 
-const MatchInsertNumFields = 12
+func (p *pgdb) InsertJob(job Job) error {
+	query := `INSERT INTO parse_jobs
+				(` + jobColumns + `)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	var user *string
+	if job.Username != "" {
+		user = &job.Username
+	}
+
+	_, err := p.transactionExec(
+		query,
+		job.Id,
+		job.DemoId,
+		job.Path,
+		job.Status,
+		job.Error,
+		job.Attempts,
+		user,
+		job.CreatedAt,
+		job.UpdatedAt,
+		job.RetryAt,
+	)
+	return err
+}
+
+func (p *pgdb) UpdateJob(job Job) error {
+	query := `UPDATE parse_jobs SET
+				status = $1,
+				error = $2,
+				attempts = $3,
+				updated_at = $4,
+				retry_at = $5
+			  WHERE id = $6`
+
+	_, err := p.transactionExec(
+		query,
+		job.Status,
+		job.Error,
+		job.Attempts,
+		job.UpdatedAt,
+		job.RetryAt,
+		job.Id,
+	)
+	return err
+}
+
+const MatchInsertNumFields = 17
 
 func (p *pgdb) UpsertMatches(matches ...Match) error {
 	params := make([]interface{}, 0, len(matches)*MatchInsertNumFields)
@@ -320,19 +439,26 @@ func (p *pgdb) UpsertMatches(matches ...Match) error {
 		rows = append(rows, value)
 	}
 
+	// A match that had to fall back to the time it was parsed keeps the
+	// date it was first parsed at, like when recomputing the dates
 	query := `INSERT INTO matches (
 				id,
 				version,
 				deleted,
 				map,
 				date,
+				date_source,
 				demo_type,
+				demo_type_confidence,
 				player_names,
 				team_a_score,
 				team_b_score,
 				team_a_title,
 				team_b_title,
-				match_data
+				match_data,
+				positions,
+				demo_root,
+				demo_path
 			  )
 			  VALUES ` + strings.Join(rows, ", ") + `
 			  ON CONFLICT (id) DO UPDATE
@@ -341,17 +467,91 @@ func (p *pgdb) UpsertMatches(matches ...Match) error {
 				version = EXCLUDED.version,
 				deleted = EXCLUDED.deleted,
 				map = EXCLUDED.map,
-				date = EXCLUDED.date,
+				date = CASE WHEN EXCLUDED.date_source = 'parsed' THEN matches.date ELSE EXCLUDED.date END,
+				date_source = EXCLUDED.date_source,
 				demo_type = EXCLUDED.demo_type,
+				demo_type_confidence = EXCLUDED.demo_type_confidence,
 				player_names = EXCLUDED.player_names,
 				team_a_score = EXCLUDED.team_a_score,
 				team_b_score = EXCLUDED.team_b_score,
 				team_a_title = EXCLUDED.team_a_title,
 				team_b_title = EXCLUDED.team_b_title,
-				match_data = EXCLUDED.match_data`
+				match_data = EXCLUDED.match_data,
+				positions = EXCLUDED.positions,
+				demo_root = EXCLUDED.demo_root,
+				demo_path = EXCLUDED.demo_path`
 
-	_, err := p.transactionExec(query, params...)
-	return err
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), query, params...)
+	if err != nil {
+		return err
+	}
+
+	// The player stats are replaced as a whole so that players who
+	// were in an older version of the match don't stick around
+	columns := getPlayerStatInsertColumns()
+	placeholders := make([]string, 0, len(columns))
+	for i := range columns {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+	}
+
+	statsQuery := `INSERT INTO match_player_stats (` + strings.Join(columns, ", ") + `)
+				   VALUES (` + strings.Join(placeholders, ", ") + `)`
+
+	weaponPlaceholders := make([]string, 0, len(playerWeaponColumns))
+	for i := range playerWeaponColumns {
+		weaponPlaceholders = append(weaponPlaceholders, "$"+strconv.Itoa(i+1))
+	}
+
+	weaponsQuery := `INSERT INTO match_player_weapons (` + strings.Join(playerWeaponColumns, ", ") + `)
+					 VALUES (` + strings.Join(weaponPlaceholders, ", ") + `)`
+
+	for _, match := range matches {
+		_, err = tx.Exec(
+			context.Background(),
+			`DELETE FROM match_player_stats WHERE match_id = $1`,
+			match.Meta.Id,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range getPlayerStatRows(match) {
+			_, err = tx.Exec(context.Background(), statsQuery, row...)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(
+			context.Background(),
+			`DELETE FROM match_player_weapons WHERE match_id = $1`,
+			match.Meta.Id,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range getPlayerWeaponRows(match) {
+			_, err = tx.Exec(context.Background(), weaponsQuery, row...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(context.Background())
 }
 
 func (p *pgdb) UpsertMatchMeta(id string, meta UserMeta) error {
@@ -388,6 +588,123 @@ func (p *pgdb) UpsertMatchMeta(id string, meta UserMeta) error {
 	return err
 }
 
+func (p *pgdb) UpsertReplays(id string, replays [][]ReplayFrame) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM replays WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for i, frames := range replays {
+		framesJson, err := json.Marshal(frames)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			context.Background(),
+			`INSERT INTO replays (match_id, round, frames) VALUES ($1, $2, $3)`,
+			id,
+			i+1,
+			string(framesJson),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) UpsertUtility(id string, utility [][]Grenade) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM utility WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for i, grenades := range utility {
+		grenadesJson, err := json.Marshal(grenades)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			context.Background(),
+			`INSERT INTO utility (match_id, round, grenades) VALUES ($1, $2, $3)`,
+			id,
+			i+1,
+			string(grenadesJson),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (p *pgdb) ReplaceRatingHistory(changes []RatingChange) error {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM rating_history`)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		_, err = tx.Exec(
+			context.Background(),
+			`INSERT INTO rating_history
+			   (match_id, steam_id, date, seq, rating_before, rating_after)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			change.MatchId,
+			strconv.FormatUint(change.SteamId, 10),
+			change.Date,
+			change.Seq,
+			change.RatingBefore,
+			change.RatingAfter,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
 func (p *pgdb) RenameMatch(oldId, newId string) error {
 	_, err := p.transactionExec(
 		`UPDATE matches SET id = $1 WHERE id = $2`,
@@ -397,6 +714,26 @@ func (p *pgdb) RenameMatch(oldId, newId string) error {
 	return err
 }
 
+func (p *pgdb) UpdateDemoPath(id string, root int, path string) error {
+	_, err := p.transactionExec(
+		`UPDATE matches SET demo_root = $1, demo_path = $2 WHERE id = $3`,
+		root,
+		path,
+		id,
+	)
+	return err
+}
+
+func (p *pgdb) UpdateMatchDate(date MatchDate) error {
+	_, err := p.transactionExec(
+		`UPDATE matches SET date = $1, date_source = $2 WHERE id = $3`,
+		date.DateTimestamp,
+		date.DateSource,
+		date.Id,
+	)
+	return err
+}
+
 func (p *pgdb) UpdateUser(username string, newInfo UserWithPassword) error {
 	numUpdates := 0
 	args := make([]interface{}, 0)
@@ -520,16 +857,23 @@ func (p *pgdb) NumUsers() (int, error) {
 	return numUsers, nil
 }
 
-func (p *pgdb) NumMatches() (int, error) {
+func (p *pgdb) NumMatches(filter MatchFilter) (int, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
 		return 0, err
 	}
 	defer conn.Release()
 
+	conditions, args := p.matchConditions(filter, nil)
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
 	var numMatches int
 	err = conn.
-		QueryRow(context.Background(), `SELECT COUNT(id) FROM matches`).
+		QueryRow(context.Background(),
+			`SELECT COUNT(id)
+			 FROM matches
+			 LEFT OUTER JOIN usermeta ON mapid = id
+			 WHERE `+strings.Join(conditions, " AND "), args...).
 		Scan(&numMatches)
 
 	if err != nil {
@@ -569,9 +913,11 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 	}
 	defer conn.Release()
 
-	var mapName, demoType, teamATitle, teamBTitle, demoLink string
+	var mapName, demoType, teamATitle, teamBTitle, demoLink, demoPath string
 	var dateTimestamp int64
-	var teamAScore, teamBScore int
+	var demoTypeConfidence float64
+	var dateSource string
+	var teamAScore, teamBScore, demoRoot int
 	var playerNames NamesMap
 	var matchData MatchData
 
@@ -581,13 +927,17 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 			`SELECT
 			   map,
 			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
 			   demo_type,
+			   demo_type_confidence,
 			   player_names,
 			   team_a_score,
 			   team_b_score,
 			   team_a_title,
 			   team_b_title,
-			   COALESCE(usermeta.demo_link, FORMAT('/api/v1/demos/%s.dem', id)) AS demo_link,
+			   COALESCE(usermeta.demo_link, '') AS demo_link,
+			   demo_root,
+			   demo_path,
 			   match_data
 		     FROM matches
 			 LEFT OUTER JOIN usermeta ON mapid = id
@@ -595,13 +945,17 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 		Scan(
 			&mapName,
 			&dateTimestamp,
+			&dateSource,
 			&demoType,
+			&demoTypeConfidence,
 			&playerNames,
 			&teamAScore,
 			&teamBScore,
 			&teamATitle,
 			&teamBTitle,
 			&demoLink,
+			&demoRoot,
+			&demoPath,
 			&matchData,
 		)
 
@@ -615,15 +969,19 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 	return &RetrievedMatch{
 		Meta: RetrievedMeta{
 			MetaData: MetaData{
-				Map:           mapName,
-				Id:            id,
-				DateTimestamp: dateTimestamp,
-				DemoType:      demoType,
-				PlayerNames:   playerNames,
-				TeamAScore:    teamAScore,
-				TeamBScore:    teamBScore,
-				TeamATitle:    teamATitle,
-				TeamBTitle:    teamBTitle,
+				Map:                mapName,
+				Id:                 id,
+				DateTimestamp:      dateTimestamp,
+				DateSource:         dateSource,
+				DemoType:           demoType,
+				DemoTypeConfidence: demoTypeConfidence,
+				PlayerNames:        playerNames,
+				TeamAScore:         teamAScore,
+				TeamBScore:         teamBScore,
+				TeamATitle:         teamATitle,
+				TeamBTitle:         teamBTitle,
+				DemoRoot:           demoRoot,
+				DemoPath:           demoPath,
 			},
 			DemoLink: demoLink,
 		},
@@ -631,109 +989,549 @@ func (p *pgdb) GetMatch(id string) (*RetrievedMatch, error) {
 	}, nil
 }
 
-func (p *pgdb) GetMatches(limit, offset int) ([]MetaData, error) {
-	return p.getMatches(limit, offset, false)
+func (p *pgdb) GetMatches(filter MatchFilter, limit, offset int) ([]MetaData, error) {
+	return p.getMatches(filter, limit, offset, false)
 }
 
-func (p *pgdb) GetDeletedMatches(limit, offset int) ([]MetaData, error) {
-	return p.getMatches(limit, offset, true)
-}
-
-func (p *pgdb) GetUserMeta(id string) (*UserMeta, error) {
+func (p *pgdb) GetDemoPath(id string) (int, string, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 	defer conn.Release()
 
-	var demoLink *string
-	var dateTimestamp *int64
-
+	var demoRoot int
+	var demoPath string
 	err = conn.
-		QueryRow(
-			context.Background(),
-			`SELECT demo_link, date_override FROM usermeta WHERE mapid = $1`,
-			id,
-		).
-		Scan(&demoLink, &dateTimestamp)
+		QueryRow(context.Background(), `SELECT demo_root, demo_path FROM matches WHERE id = $1`, id).
+		Scan(&demoRoot, &demoPath)
 
 	if err != nil {
 		if err.Error() == "no rows in result set" {
-			return nil, nil
+			return 0, "", nil
 		}
-		return nil, err
-	}
-
-	var dateOverride int64 = 0
-	if dateTimestamp != nil {
-		dateOverride = *dateTimestamp
-	}
-
-	var demoLinkFinal string = ""
-	if demoLink != nil {
-		demoLinkFinal = *demoLink
+		return 0, "", err
 	}
 
-	return &UserMeta{
-		DemoLink:     demoLinkFinal,
-		DateOverride: dateOverride,
-	}, nil
-}
-
-func (p *pgdb) GetUser(username string) (*User, error) {
-	return p.getUser(username, nil)
+	return demoRoot, demoPath, nil
 }
 
-func (p *pgdb) GetUsers() ([]User, error) {
+func (p *pgdb) GetMatchDates() ([]MatchDate, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Release()
 
-	query := `SELECT username, display_name, email, roles, steam_id FROM users`
-	rows, err := conn.Query(context.Background(), query)
-
-	users := make([]User, 0, 10)
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT id, date, date_source, demo_root, demo_path FROM matches ORDER BY date`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	dates := make([]MatchDate, 0)
 	for rows.Next() {
-		var username, displayName, email string
-		var steamId *string
-		var roles []string
-
-		err = rows.Scan(&username, &displayName, &email, &roles, &steamId)
-
+		var date MatchDate
+		err = rows.Scan(&date.Id, &date.DateTimestamp, &date.DateSource, &date.DemoRoot, &date.DemoPath)
 		if err != nil {
 			return nil, err
 		}
+		dates = append(dates, date)
+	}
 
-		finalSteamId := ""
-		if steamId != nil {
-			finalSteamId = *steamId
-		}
+	return dates, rows.Err()
+}
 
-		users = append(users,
-			User{
-				Username:    username,
-				DisplayName: displayName,
-				Email:       email,
-				Roles:       roles,
-				SteamId:     finalSteamId,
-			})
+func (p *pgdb) GetDeletedMatches(limit, offset int) ([]MetaData, error) {
+	return p.getMatches(MatchFilter{}, limit, offset, true)
+}
+
+func (p *pgdb) playerConditions(filter PlayerFilter, table string) ([]string, []interface{}) {
+	// The player is filtered on their own rows instead of player_names
+	// so that the steam ID index is used
+	matchFilter := filter.matchFilter()
+	matchFilter.SteamId = 0
+
+	conditions, args := p.matchConditions(matchFilter, nil)
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
+	if filter.SteamId != 0 {
+		args = append(args, strconv.FormatUint(filter.SteamId, 10))
+		conditions = append(conditions, table+`.steam_id = $`+strconv.Itoa(len(args)))
 	}
 
-	return users, nil
+	return conditions, args
 }
 
-func (p *pgdb) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+func (p *pgdb) GetPlayerCareers(filter PlayerFilter) ([]PlayerMapCareer, error) {
 	conn, err := p.dbpool.Acquire(context.Background())
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Release()
 
-	query := `SELECT
-				timestamp,
+	conditions, args := p.playerConditions(filter, "match_player_stats")
+	rows, err := conn.Query(context.Background(), playerCareersQuery(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	careers := make([]PlayerMapCareer, 0)
+	for rows.Next() {
+		career, err := scanPlayerCareer(rows)
+		if err != nil {
+			return nil, err
+		}
+		careers = append(careers, career)
+	}
+
+	return careers, rows.Err()
+}
+
+func (p *pgdb) GetPlayerMatches(filter PlayerFilter) ([]PlayerMatchSummary, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	conditions, args := p.playerConditions(filter, "match_player_stats")
+	rows, err := conn.
+		Query(context.Background(),
+			`SELECT
+			   id,
+			   map,
+			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
+			   demo_type,
+			   demo_type_confidence,
+			   player_names,
+			   team_a_score,
+			   team_b_score,
+			   team_a_title,
+			   team_b_title,
+			   match_player_stats.team,
+			   kills,
+			   deaths,
+			   assists,
+			   adr,
+			   hltv,
+			   kast
+			 FROM match_player_stats
+			 JOIN matches ON matches.id = match_player_stats.match_id
+			 LEFT OUTER JOIN usermeta ON mapid = matches.id
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 ORDER BY date DESC`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]PlayerMatchSummary, 0, 10)
+	for rows.Next() {
+		var match PlayerMatchSummary
+		var team string
+
+		err = rows.Scan(
+			&match.Meta.Id, &match.Meta.Map, &match.Meta.DateTimestamp, &match.Meta.DateSource,
+			&match.Meta.DemoType, &match.Meta.DemoTypeConfidence, &match.Meta.PlayerNames,
+			&match.Meta.TeamAScore, &match.Meta.TeamBScore, &match.Meta.TeamATitle, &match.Meta.TeamBTitle,
+			&team, &match.Kills, &match.Deaths, &match.Assists, &match.Adr, &match.Hltv, &match.Kast,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		match.Result = playerMatchResult(team, match.Meta.TeamAScore, match.Meta.TeamBScore)
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+func (p *pgdb) GetPlayerWeapons(filter PlayerFilter) (map[string]WeaponStats, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	conditions, args := p.playerConditions(filter, "match_player_weapons")
+	rows, err := conn.Query(context.Background(), playerWeaponsQuery(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weapons := make(map[string]WeaponStats)
+	for rows.Next() {
+		weapon, stats, err := scanPlayerWeapon(rows)
+		if err != nil {
+			return nil, err
+		}
+		weapons[weapon] = stats
+	}
+
+	return weapons, rows.Err()
+}
+
+func (p *pgdb) GetLeaderboard(filter LeaderboardFilter) ([]LeaderboardEntry, error) {
+	metric, ok := LeaderboardMetrics[filter.Metric]
+	if !ok {
+		return nil, errors.New("unknown leaderboard metric \"" + filter.Metric + "\"")
+	}
+
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	conditions, args := p.matchConditions(filter.matchFilter(), []interface{}{filter.MinMatches, filter.Limit})
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
+	if len(filter.SteamIds) != 0 {
+		ids := make([]string, 0, len(filter.SteamIds))
+		for _, steamId := range filter.SteamIds {
+			ids = append(ids, strconv.FormatUint(steamId, 10))
+		}
+
+		args = append(args, ids)
+		conditions = append(conditions, `match_player_stats.steam_id = ANY($`+strconv.Itoa(len(args))+`)`)
+	}
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+
+	rows, err := conn.
+		Query(context.Background(),
+			`SELECT
+			   match_player_stats.steam_id,
+			   `+latestPlayerNameQuery+`,
+			   COUNT(*),
+			   `+metric.valueExpr("DOUBLE PRECISION")+` AS value
+			 FROM match_player_stats
+			 JOIN matches ON matches.id = match_player_stats.match_id
+			 LEFT OUTER JOIN usermeta ON mapid = matches.id
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 GROUP BY match_player_stats.steam_id
+			 HAVING COUNT(*) >= $1
+			 ORDER BY value `+direction+`, match_player_stats.steam_id
+			 LIMIT $2`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]LeaderboardEntry, 0, filter.Limit)
+	for rows.Next() {
+		var steamId, name string
+		var entry LeaderboardEntry
+
+		err = rows.Scan(&steamId, &name, &entry.Matches, &entry.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.SteamId, err = strconv.ParseUint(steamId, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Name = name
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (p *pgdb) GetRatingMatches() ([]RatingMatch, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(context.Background(), ratingMatchesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]RatingMatch, 0)
+	for rows.Next() {
+		matches, err = scanRatingMatch(rows, matches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, rows.Err()
+}
+
+func (p *pgdb) GetRatingHistory(steamId uint64) ([]RatingChange, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(
+		context.Background(),
+		`SELECT match_id, date, seq, rating_before, rating_after
+		 FROM rating_history
+		 WHERE steam_id = $1
+		 ORDER BY seq`,
+		strconv.FormatUint(steamId, 10),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]RatingChange, 0)
+	for rows.Next() {
+		change := RatingChange{SteamId: steamId}
+		err = rows.Scan(
+			&change.MatchId,
+			&change.Date,
+			&change.Seq,
+			&change.RatingBefore,
+			&change.RatingAfter,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+func (p *pgdb) GetRatings(steamIds []uint64) ([]PlayerRating, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	ids := make([]string, 0, len(steamIds))
+	for _, steamId := range steamIds {
+		ids = append(ids, strconv.FormatUint(steamId, 10))
+	}
+
+	rows, err := conn.Query(
+		context.Background(),
+		ratingsQuery+` AND rating.steam_id = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := make([]PlayerRating, 0, len(steamIds))
+	for rows.Next() {
+		rating, err := scanPlayerRating(rows)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+func (p *pgdb) GetMatchPositions(id string) ([]PositionEvent, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var positions []PositionEvent
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT positions FROM matches WHERE id = $1 AND deleted = FALSE`,
+			id,
+		).
+		Scan(&positions)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+func (p *pgdb) GetReplay(id string, round int) ([]ReplayFrame, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var frames []ReplayFrame
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT frames
+			 FROM replays
+			 JOIN matches ON matches.id = replays.match_id
+			 WHERE replays.match_id = $1 AND replays.round = $2 AND matches.deleted = FALSE`,
+			id,
+			round,
+		).
+		Scan(&frames)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+func (p *pgdb) GetUtility(id string, round int) ([]Grenade, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var grenades []Grenade
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT grenades
+			 FROM utility
+			 JOIN matches ON matches.id = utility.match_id
+			 WHERE utility.match_id = $1 AND utility.round = $2 AND matches.deleted = FALSE`,
+			id,
+			round,
+		).
+		Scan(&grenades)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return grenades, nil
+}
+
+func (p *pgdb) GetUserMeta(id string) (*UserMeta, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	var demoLink *string
+	var dateTimestamp *int64
+
+	err = conn.
+		QueryRow(
+			context.Background(),
+			`SELECT demo_link, date_override FROM usermeta WHERE mapid = $1`,
+			id,
+		).
+		Scan(&demoLink, &dateTimestamp)
+
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dateOverride int64 = 0
+	if dateTimestamp != nil {
+		dateOverride = *dateTimestamp
+	}
+
+	var demoLinkFinal string = ""
+	if demoLink != nil {
+		demoLinkFinal = *demoLink
+	}
+
+	return &UserMeta{
+		DemoLink:     demoLinkFinal,
+		DateOverride: dateOverride,
+	}, nil
+}
+
+func (p *pgdb) GetUser(username string) (*User, error) {
+	return p.getUser(username, nil)
+}
+
+func (p *pgdb) GetUsers() ([]User, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	query := `SELECT username, display_name, email, roles, steam_id FROM users`
+	rows, err := conn.Query(context.Background(), query)
+
+	users := make([]User, 0, 10)
+
+	for rows.Next() {
+		var username, displayName, email string
+		var steamId *string
+		var roles []string
+
+		err = rows.Scan(&username, &displayName, &email, &roles, &steamId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		finalSteamId := ""
+		if steamId != nil {
+			finalSteamId = *steamId
+		}
+
+		users = append(users,
+			User{
+				Username:    username,
+				DisplayName: displayName,
+				Email:       email,
+				Roles:       roles,
+				SteamId:     finalSteamId,
+			})
+	}
+
+	return users, nil
+}
+
+func (p *pgdb) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	query := `SELECT
+				timestamp,
 				system,
 				username,
 				action,
@@ -775,6 +1573,129 @@ func (p *pgdb) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
 	return users, nil
 }
 
+func (p *pgdb) GetJob(id string) (*Job, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	row := conn.QueryRow(
+		context.Background(),
+		`SELECT `+jobColumns+` FROM parse_jobs WHERE id = $1`,
+		id,
+	)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (p *pgdb) GetJobs(status string, limit, offset int) ([]Job, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	query := `SELECT ` + jobColumns + `
+			  FROM parse_jobs
+			  WHERE $1 = '' OR status = $1
+			  ORDER BY created_at DESC
+			  LIMIT $2 OFFSET $3`
+	rows, err := conn.Query(context.Background(), query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0, limit)
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (p *pgdb) GetLatestJob(path string) (*Job, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	row := conn.QueryRow(
+		context.Background(),
+		`SELECT `+jobColumns+`
+		 FROM parse_jobs
+		 WHERE path = $1
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		path,
+	)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (p *pgdb) ClaimJob() (*Job, error) {
+	conn, err := p.dbpool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	// SKIP LOCKED stops two workers from grabbing the same job
+	query := `UPDATE parse_jobs SET
+				status = $1,
+				attempts = attempts + 1,
+				updated_at = $2
+			  WHERE id = (
+				SELECT id FROM parse_jobs
+				WHERE status = $3 AND retry_at <= $2
+				ORDER BY created_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			  )
+			  RETURNING ` + jobColumns
+
+	row := conn.QueryRow(
+		context.Background(),
+		query,
+		JobRunning,
+		time.Now().UnixMilli(),
+		JobQueued,
+	)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
 func (p *pgdb) Login(username, password string) (*User, error) {
 	return p.getUser(username, &password)
 }
@@ -818,6 +1739,26 @@ func (p *pgdb) CleanInvalidTokens() error {
 	return err
 }
 
+func (p *pgdb) RequeueRunningJobs() error {
+	_, err := p.transactionExec(
+		`UPDATE parse_jobs SET status = $1, updated_at = $2 WHERE status = $3`,
+		JobQueued,
+		time.Now().UnixMilli(),
+		JobRunning,
+	)
+	return err
+}
+
+func (p *pgdb) CleanFinishedJobs(before int64) error {
+	_, err := p.transactionExec(
+		`DELETE FROM parse_jobs WHERE status IN ($1, $2) AND updated_at < $3`,
+		JobDone,
+		JobFailed,
+		before,
+	)
+	return err
+}
+
 func (p *pgdb) RunMigration(config Config, dir string) error {
 	m, err := p.createMigrationClient(config)
 	if err != nil {
@@ -846,8 +1787,29 @@ func (p *pgdb) SoftDeleteMatch(id string) error {
 		   version = 0,
 		   deleted = TRUE,
 		   match_data = '{}',
-		   player_names = '{}'
+		   player_names = '{}',
+		   positions = '[]'
 	     WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transactionExec(`DELETE FROM replays WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transactionExec(`DELETE FROM utility WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transactionExec(`DELETE FROM match_player_stats WHERE match_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.transactionExec(`DELETE FROM match_player_weapons WHERE match_id = $1`, id)
 	return err
 }
 
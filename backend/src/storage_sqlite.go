@@ -0,0 +1,1613 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "modernc.org/sqlite"
+)
+
+/********************************************************/
+/*                   Private methods                    */
+/********************************************************/
+
+// SQLite implementation of the Storage interface. The connection string is
+// the path to the database file. The queries here are kept as close to the
+// Postgres ones as possible, the main differences being that the JSON
+// columns are stored as text and SQLite uses ? for its query parameters
+type sqlitedb struct {
+	db *sql.DB
+}
+
+func newSqliteDb(config Config, logger *Logger) (*sqlitedb, error) {
+	dsn := "file:" + config.dbConnString +
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		logger.Errorf("Failed to open database: %s", err.Error())
+		return &sqlitedb{}, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		logger.Errorf("Failed to connect to database: %s", err.Error())
+		return &sqlitedb{}, err
+	}
+
+	return &sqlitedb{
+		db: db,
+	}, nil
+}
+
+func (s *sqlitedb) transactionExec(query string, arguments ...interface{}) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, arguments...)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *sqlitedb) getUser(username string, password *string) (*User, error) {
+	var displayName, email, passwordArgon, rolesJson string
+	var steamIdScanned *string
+
+	err := s.db.
+		QueryRow(
+			`SELECT
+				display_name,
+				email,
+				password_argon,
+				roles,
+				steam_id
+			FROM users WHERE username = ?`,
+			username,
+		).
+		Scan(&displayName, &email, &passwordArgon, &rolesJson, &steamIdScanned)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if password != nil {
+		argon2ID := NewArgon2ID()
+		passwordOk, err := argon2ID.Verify(*password, passwordArgon)
+		if err != nil {
+			return nil, err
+		}
+
+		if !passwordOk {
+			return nil, errors.New("wrong password")
+		}
+	}
+
+	var roles []string
+	err = json.Unmarshal([]byte(rolesJson), &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	steamId := ""
+	if steamIdScanned != nil {
+		steamId = *steamIdScanned
+	}
+
+	return &User{
+		Username:    username,
+		DisplayName: displayName,
+		Email:       email,
+		Roles:       roles,
+		SteamId:     steamId,
+	}, nil
+}
+
+func (s *sqlitedb) createMigrationClient(config Config) (*migrate.Migrate, error) {
+	return migrate.New(
+		"file://"+join(config.migrationsPath, "sqlite"),
+		"sqlite://"+config.dbConnString)
+}
+
+func (s *sqlitedb) genMatchInsert(match Match, params *[]interface{}) (string, error) {
+	player_names, err := json.Marshal(match.Meta.PlayerNames)
+	if err != nil {
+		return "", err
+	}
+
+	match_data, err := json.Marshal(match.MatchData)
+	if err != nil {
+		return "", err
+	}
+
+	positions, err := json.Marshal(match.Positions)
+	if err != nil {
+		return "", err
+	}
+
+	*params = append(*params,
+		match.Meta.Id,
+		ParserVersion,
+		false,
+		match.Meta.Map,
+		match.Meta.DateTimestamp,
+		match.Meta.DateSource,
+		match.Meta.DemoType,
+		match.Meta.DemoTypeConfidence,
+		string(player_names),
+		match.Meta.TeamAScore,
+		match.Meta.TeamBScore,
+		match.Meta.TeamATitle,
+		match.Meta.TeamBTitle,
+		string(match_data),
+		string(positions),
+		match.Meta.DemoRoot,
+		match.Meta.DemoPath,
+	)
+
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", MatchInsertNumFields), ", ") + ")", nil
+}
+
+// Build the WHERE conditions and their arguments for the filter
+func (s *sqlitedb) matchConditions(filter MatchFilter) ([]string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if filter.SteamId != 0 {
+		args = append(args, strconv.FormatUint(filter.SteamId, 10))
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(player_names) WHERE key = ?)`)
+	}
+
+	if filter.From != 0 {
+		args = append(args, filter.From)
+		conditions = append(conditions, `COALESCE(usermeta.date_override, matches.date) >= ?`)
+	}
+
+	if filter.To != 0 {
+		args = append(args, filter.To)
+		conditions = append(conditions, `COALESCE(usermeta.date_override, matches.date) <= ?`)
+	}
+
+	if filter.Map != "" {
+		args = append(args, filter.Map)
+		conditions = append(conditions, `map = ?`)
+	}
+
+	if filter.DemoType != "" {
+		args = append(args, filter.DemoType)
+		conditions = append(conditions, `demo_type = ?`)
+	}
+
+	if filter.Team != "" {
+		team := strings.ToLower(filter.Team)
+		args = append(args, team, team)
+		conditions = append(conditions, `(LOWER(team_a_title) = ? OR LOWER(team_b_title) = ?)`)
+	}
+
+	if filter.HasScore {
+		args = append(args, filter.HighScore, filter.LowScore)
+		conditions = append(conditions,
+			`MAX(team_a_score, team_b_score) = ?`,
+			`MIN(team_a_score, team_b_score) = ?`)
+	}
+
+	return conditions, args
+}
+
+func (s *sqlitedb) getMatches(filter MatchFilter, limit, offset int, deleted bool) ([]MetaData, error) {
+	conditions, args := s.matchConditions(filter)
+	conditions = append([]string{`deleted = ?`}, conditions...)
+	args = append([]interface{}{deleted}, args...)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.
+		Query(
+			`SELECT
+			   id,
+			   map,
+			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
+			   demo_type,
+			   demo_type_confidence,
+			   player_names,
+			   team_a_score,
+			   team_b_score,
+			   team_a_title,
+			   team_b_title
+			 FROM matches
+			 LEFT OUTER JOIN usermeta ON mapid = id
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 `+matchOrderBy(filter)+`
+			 LIMIT ? OFFSET ?`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]MetaData, 0, 10)
+	for rows.Next() {
+		var id, mapName, demoType, teamATitle, teamBTitle, playerNamesJson string
+		var dateTimestamp int64
+		var demoTypeConfidence float64
+		var dateSource string
+		var teamAScore, teamBScore int
+		var playerNames NamesMap
+
+		err = rows.Scan(
+			&id, &mapName, &dateTimestamp, &dateSource, &demoType, &demoTypeConfidence, &playerNamesJson,
+			&teamAScore, &teamBScore, &teamATitle, &teamBTitle,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(playerNamesJson), &playerNames)
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches,
+			MetaData{
+				Map:                mapName,
+				Id:                 id,
+				DateTimestamp:      dateTimestamp,
+				DateSource:         dateSource,
+				DemoType:           demoType,
+				DemoTypeConfidence: demoTypeConfidence,
+				PlayerNames:        playerNames,
+				TeamAScore:         teamAScore,
+				TeamBScore:         teamBScore,
+				TeamATitle:         teamATitle,
+				TeamBTitle:         teamBTitle,
+			})
+	}
+
+	return matches, rows.Err()
+}
+
+func (s *sqlitedb) count(query string) (int, error) {
+	var count int
+	err := s.db.QueryRow(query).Scan(&count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+/********************************************************/
+/*              Storage interface methods               */
+/********************************************************/
+
+func (s *sqlitedb) InsertUser(user User, password string) error {
+	var steamId *string = nil
+	if user.SteamId != "" {
+		steamId = &user.SteamId
+	}
+
+	argon2ID := NewArgon2ID()
+	passwordArgon, err := argon2ID.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	roles, err := json.Marshal(user.Roles)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users (
+				username,
+				display_name,
+				email,
+				password_argon,
+				roles,
+				steam_id
+			) VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err = s.transactionExec(query,
+		user.Username,
+		user.DisplayName,
+		user.Email,
+		passwordArgon,
+		string(roles),
+		steamId,
+	)
+
+	return err
+}
+
+func (s *sqlitedb) InsertAuditEntry(entry AuditEntry) error {
+	query := `INSERT INTO auditlog
+				(timestamp, system, username, action, description)
+			  VALUES (?, ?, ?, ?, ?)`
+
+	var user *string
+	if entry.Username != "" {
+		user = &entry.Username
+	}
+
+	_, err := s.transactionExec(
+		query,
+		time.Now().UnixMilli(),
+		entry.System,
+		user,
+		entry.Action,
+		entry.Description,
+	)
+	return err
+}
+
+func (s *sqlitedb) InsertJob(job Job) error {
+	query := `INSERT INTO parse_jobs
+				(` + jobColumns + `)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var user *string
+	if job.Username != "" {
+		user = &job.Username
+	}
+
+	_, err := s.transactionExec(
+		query,
+		job.Id,
+		job.DemoId,
+		job.Path,
+		job.Status,
+		job.Error,
+		job.Attempts,
+		user,
+		job.CreatedAt,
+		job.UpdatedAt,
+		job.RetryAt,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpdateJob(job Job) error {
+	query := `UPDATE parse_jobs SET
+				status = ?,
+				error = ?,
+				attempts = ?,
+				updated_at = ?,
+				retry_at = ?
+			  WHERE id = ?`
+
+	_, err := s.transactionExec(
+		query,
+		job.Status,
+		job.Error,
+		job.Attempts,
+		job.UpdatedAt,
+		job.RetryAt,
+		job.Id,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpsertMatches(matches ...Match) error {
+	params := make([]interface{}, 0, len(matches)*MatchInsertNumFields)
+	rows := make([]string, 0, len(matches))
+
+	for _, match := range matches {
+		value, err := s.genMatchInsert(match, &params)
+		if err != nil {
+			return err
+		}
+
+		rows = append(rows, value)
+	}
+
+	// A match that had to fall back to the time it was parsed keeps the
+	// date it was first parsed at, like when recomputing the dates
+	query := `INSERT INTO matches (
+				id,
+				version,
+				deleted,
+				map,
+				date,
+				date_source,
+				demo_type,
+				demo_type_confidence,
+				player_names,
+				team_a_score,
+				team_b_score,
+				team_a_title,
+				team_b_title,
+				match_data,
+				positions,
+				demo_root,
+				demo_path
+			  )
+			  VALUES ` + strings.Join(rows, ", ") + `
+			  ON CONFLICT (id) DO UPDATE
+			  SET
+				version = excluded.version,
+				deleted = excluded.deleted,
+				map = excluded.map,
+				date = CASE WHEN excluded.date_source = 'parsed' THEN matches.date ELSE excluded.date END,
+				date_source = excluded.date_source,
+				demo_type = excluded.demo_type,
+				demo_type_confidence = excluded.demo_type_confidence,
+				player_names = excluded.player_names,
+				team_a_score = excluded.team_a_score,
+				team_b_score = excluded.team_b_score,
+				team_a_title = excluded.team_a_title,
+				team_b_title = excluded.team_b_title,
+				match_data = excluded.match_data,
+				positions = excluded.positions,
+				demo_root = excluded.demo_root,
+				demo_path = excluded.demo_path`
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, params...)
+	if err != nil {
+		return err
+	}
+
+	// The player stats are replaced as a whole so that players who
+	// were in an older version of the match don't stick around
+	columns := getPlayerStatInsertColumns()
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	statsQuery := `INSERT INTO match_player_stats (` + strings.Join(columns, ", ") + `)
+				   VALUES (` + placeholders + `)`
+
+	weaponPlaceholders := strings.TrimSuffix(strings.Repeat("?, ", len(playerWeaponColumns)), ", ")
+	weaponsQuery := `INSERT INTO match_player_weapons (` + strings.Join(playerWeaponColumns, ", ") + `)
+					 VALUES (` + weaponPlaceholders + `)`
+
+	for _, match := range matches {
+		_, err = tx.Exec(`DELETE FROM match_player_stats WHERE match_id = ?`, match.Meta.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range getPlayerStatRows(match) {
+			_, err = tx.Exec(statsQuery, row...)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`DELETE FROM match_player_weapons WHERE match_id = ?`, match.Meta.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range getPlayerWeaponRows(match) {
+			_, err = tx.Exec(weaponsQuery, row...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlitedb) UpsertMatchMeta(id string, meta UserMeta) error {
+	// If everything is null just delete the whole entry
+	if meta.DemoLink == "" && meta.DateOverride == 0 {
+		_, err := s.transactionExec(
+			`DELETE FROM usermeta WHERE mapid = ?`,
+			id,
+		)
+		return err
+	}
+
+	var dateOverride *int64
+	if meta.DateOverride != 0 {
+		dateOverride = &meta.DateOverride
+	}
+
+	var demoLink *string
+	if meta.DemoLink != "" {
+		demoLink = &meta.DemoLink
+	}
+
+	_, err := s.transactionExec(
+		`INSERT INTO usermeta (mapid, demo_link, date_override)
+		VALUES (?, ?, ?)
+		ON CONFLICT (mapid) DO UPDATE
+		SET
+		  demo_link = excluded.demo_link,
+		  date_override = excluded.date_override`,
+		id,
+		demoLink,
+		dateOverride,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpsertReplays(id string, replays [][]ReplayFrame) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM replays WHERE match_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for i, frames := range replays {
+		framesJson, err := json.Marshal(frames)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO replays (match_id, round, frames) VALUES (?, ?, ?)`,
+			id,
+			i+1,
+			string(framesJson),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlitedb) UpsertUtility(id string, utility [][]Grenade) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM utility WHERE match_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for i, grenades := range utility {
+		grenadesJson, err := json.Marshal(grenades)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO utility (match_id, round, grenades) VALUES (?, ?, ?)`,
+			id,
+			i+1,
+			string(grenadesJson),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlitedb) ReplaceRatingHistory(changes []RatingChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM rating_history`)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		_, err = tx.Exec(
+			`INSERT INTO rating_history
+			   (match_id, steam_id, date, seq, rating_before, rating_after)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			change.MatchId,
+			strconv.FormatUint(change.SteamId, 10),
+			change.Date,
+			change.Seq,
+			change.RatingBefore,
+			change.RatingAfter,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlitedb) RenameMatch(oldId, newId string) error {
+	_, err := s.transactionExec(
+		`UPDATE matches SET id = ? WHERE id = ?`,
+		newId,
+		oldId,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpdateDemoPath(id string, root int, path string) error {
+	_, err := s.transactionExec(
+		`UPDATE matches SET demo_root = ?, demo_path = ? WHERE id = ?`,
+		root,
+		path,
+		id,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpdateMatchDate(date MatchDate) error {
+	_, err := s.transactionExec(
+		`UPDATE matches SET date = ?, date_source = ? WHERE id = ?`,
+		date.DateTimestamp,
+		date.DateSource,
+		date.Id,
+	)
+	return err
+}
+
+func (s *sqlitedb) UpdateUser(username string, newInfo UserWithPassword) error {
+	args := make([]interface{}, 0)
+
+	var updates []string
+	if newInfo.DisplayName != "" {
+		updates = append(updates, `display_name = ?`)
+		args = append(args, newInfo.DisplayName)
+	}
+
+	if newInfo.Email != "" {
+		updates = append(updates, `email = ?`)
+		args = append(args, newInfo.Email)
+	}
+
+	if newInfo.SteamId != "" {
+		updates = append(updates, `steam_id = ?`)
+		args = append(args, newInfo.SteamId)
+	}
+
+	if newInfo.Username != "" {
+		updates = append(updates, `username = ?`)
+		args = append(args, newInfo.Username)
+	}
+
+	if newInfo.Roles != nil {
+		roles, err := json.Marshal(newInfo.Roles)
+		if err != nil {
+			return err
+		}
+
+		updates = append(updates, `roles = ?`)
+		args = append(args, string(roles))
+	}
+
+	if newInfo.Password != "" {
+		argon2ID := NewArgon2ID()
+		passwordArgon, err := argon2ID.Hash(newInfo.Password)
+		if err != nil {
+			return err
+		}
+
+		updates = append(updates, `password_argon = ?`)
+		args = append(args, passwordArgon)
+	}
+
+	if len(updates) == 0 {
+		return errors.New("no fields were updated")
+	}
+
+	args = append(args, username)
+	updatesString := strings.Join(updates, ", ")
+	query := `UPDATE users SET ` + updatesString + ` WHERE username = ?`
+	_, err := s.transactionExec(query, args...)
+	return err
+}
+
+func (s *sqlitedb) HasMatch(id string) (bool, int, error) {
+	returnedVersion := 0
+	returnedId := ""
+
+	err := s.db.
+		QueryRow("SELECT id, version FROM matches WHERE id = ?", id).
+		Scan(&returnedId, &returnedVersion)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, err
+	}
+
+	return returnedId == id, returnedVersion, nil
+}
+
+func (s *sqlitedb) HasUser(username string) (bool, error) {
+	var count int
+	err := s.db.
+		QueryRow("SELECT COUNT(username) FROM users WHERE username = ?", username).
+		Scan(&count)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+func (s *sqlitedb) NumUsers() (int, error) {
+	return s.count(`SELECT COUNT(username) FROM users`)
+}
+
+func (s *sqlitedb) NumMatches(filter MatchFilter) (int, error) {
+	conditions, args := s.matchConditions(filter)
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
+	var numMatches int
+	err := s.db.
+		QueryRow(
+			`SELECT COUNT(id)
+			 FROM matches
+			 LEFT OUTER JOIN usermeta ON mapid = id
+			 WHERE `+strings.Join(conditions, " AND "), args...).
+		Scan(&numMatches)
+	return numMatches, err
+}
+
+func (s *sqlitedb) NumAuditLogEntries() (int, error) {
+	return s.count(`SELECT COUNT(timestamp) FROM auditlog`)
+}
+
+func (s *sqlitedb) GetMatch(id string) (*RetrievedMatch, error) {
+	var mapName, demoType, teamATitle, teamBTitle, demoLink, demoPath string
+	var playerNamesJson, matchDataJson string
+	var dateTimestamp int64
+	var demoTypeConfidence float64
+	var dateSource string
+	var teamAScore, teamBScore, demoRoot int
+
+	err := s.db.
+		QueryRow(
+			`SELECT
+			   map,
+			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
+			   demo_type,
+			   demo_type_confidence,
+			   player_names,
+			   team_a_score,
+			   team_b_score,
+			   team_a_title,
+			   team_b_title,
+			   COALESCE(usermeta.demo_link, '') AS demo_link,
+			   demo_root,
+			   demo_path,
+			   match_data
+		     FROM matches
+			 LEFT OUTER JOIN usermeta ON mapid = id
+			 WHERE id = ? AND deleted = FALSE`, id).
+		Scan(
+			&mapName,
+			&dateTimestamp,
+			&dateSource,
+			&demoType,
+			&demoTypeConfidence,
+			&playerNamesJson,
+			&teamAScore,
+			&teamBScore,
+			&teamATitle,
+			&teamBTitle,
+			&demoLink,
+			&demoRoot,
+			&demoPath,
+			&matchDataJson,
+		)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var playerNames NamesMap
+	err = json.Unmarshal([]byte(playerNamesJson), &playerNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var matchData MatchData
+	err = json.Unmarshal([]byte(matchDataJson), &matchData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetrievedMatch{
+		Meta: RetrievedMeta{
+			MetaData: MetaData{
+				Map:                mapName,
+				Id:                 id,
+				DateTimestamp:      dateTimestamp,
+				DateSource:         dateSource,
+				DemoType:           demoType,
+				DemoTypeConfidence: demoTypeConfidence,
+				PlayerNames:        playerNames,
+				TeamAScore:         teamAScore,
+				TeamBScore:         teamBScore,
+				TeamATitle:         teamATitle,
+				TeamBTitle:         teamBTitle,
+				DemoRoot:           demoRoot,
+				DemoPath:           demoPath,
+			},
+			DemoLink: demoLink,
+		},
+		MatchData: matchData,
+	}, nil
+}
+
+func (s *sqlitedb) GetMatches(filter MatchFilter, limit, offset int) ([]MetaData, error) {
+	return s.getMatches(filter, limit, offset, false)
+}
+
+func (s *sqlitedb) GetDemoPath(id string) (int, string, error) {
+	var demoRoot int
+	var demoPath string
+	err := s.db.
+		QueryRow(`SELECT demo_root, demo_path FROM matches WHERE id = ?`, id).
+		Scan(&demoRoot, &demoPath)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", nil
+		}
+		return 0, "", err
+	}
+
+	return demoRoot, demoPath, nil
+}
+
+func (s *sqlitedb) GetMatchDates() ([]MatchDate, error) {
+	rows, err := s.db.Query(`SELECT id, date, date_source, demo_root, demo_path FROM matches ORDER BY date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make([]MatchDate, 0)
+	for rows.Next() {
+		var date MatchDate
+		err = rows.Scan(&date.Id, &date.DateTimestamp, &date.DateSource, &date.DemoRoot, &date.DemoPath)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+
+	return dates, rows.Err()
+}
+
+func (s *sqlitedb) GetDeletedMatches(limit, offset int) ([]MetaData, error) {
+	return s.getMatches(MatchFilter{}, limit, offset, true)
+}
+
+func (s *sqlitedb) playerConditions(filter PlayerFilter, table string) ([]string, []interface{}) {
+	// The player is filtered on their own rows instead of player_names
+	// so that the steam ID index is used
+	matchFilter := filter.matchFilter()
+	matchFilter.SteamId = 0
+
+	conditions, args := s.matchConditions(matchFilter)
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
+	if filter.SteamId != 0 {
+		args = append(args, strconv.FormatUint(filter.SteamId, 10))
+		conditions = append(conditions, table+`.steam_id = ?`)
+	}
+
+	return conditions, args
+}
+
+func (s *sqlitedb) GetPlayerCareers(filter PlayerFilter) ([]PlayerMapCareer, error) {
+	conditions, args := s.playerConditions(filter, "match_player_stats")
+	rows, err := s.db.Query(playerCareersQuery(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	careers := make([]PlayerMapCareer, 0)
+	for rows.Next() {
+		career, err := scanPlayerCareer(rows)
+		if err != nil {
+			return nil, err
+		}
+		careers = append(careers, career)
+	}
+
+	return careers, rows.Err()
+}
+
+func (s *sqlitedb) GetPlayerMatches(filter PlayerFilter) ([]PlayerMatchSummary, error) {
+	conditions, args := s.playerConditions(filter, "match_player_stats")
+	rows, err := s.db.
+		Query(
+			`SELECT
+			   id,
+			   map,
+			   COALESCE(usermeta.date_override, matches.date) AS date,
+			   CASE WHEN usermeta.date_override IS NULL THEN matches.date_source ELSE 'override' END,
+			   demo_type,
+			   demo_type_confidence,
+			   player_names,
+			   team_a_score,
+			   team_b_score,
+			   team_a_title,
+			   team_b_title,
+			   match_player_stats.team,
+			   kills,
+			   deaths,
+			   assists,
+			   adr,
+			   hltv,
+			   kast
+			 FROM match_player_stats
+			 JOIN matches ON matches.id = match_player_stats.match_id
+			 LEFT OUTER JOIN usermeta ON mapid = matches.id
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 ORDER BY date DESC`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]PlayerMatchSummary, 0, 10)
+	for rows.Next() {
+		var match PlayerMatchSummary
+		var team, playerNamesJson string
+
+		err = rows.Scan(
+			&match.Meta.Id, &match.Meta.Map, &match.Meta.DateTimestamp, &match.Meta.DateSource,
+			&match.Meta.DemoType, &match.Meta.DemoTypeConfidence, &playerNamesJson,
+			&match.Meta.TeamAScore, &match.Meta.TeamBScore, &match.Meta.TeamATitle, &match.Meta.TeamBTitle,
+			&team, &match.Kills, &match.Deaths, &match.Assists, &match.Adr, &match.Hltv, &match.Kast,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(playerNamesJson), &match.Meta.PlayerNames)
+		if err != nil {
+			return nil, err
+		}
+
+		match.Result = playerMatchResult(team, match.Meta.TeamAScore, match.Meta.TeamBScore)
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+func (s *sqlitedb) GetPlayerWeapons(filter PlayerFilter) (map[string]WeaponStats, error) {
+	conditions, args := s.playerConditions(filter, "match_player_weapons")
+	rows, err := s.db.Query(playerWeaponsQuery(conditions), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weapons := make(map[string]WeaponStats)
+	for rows.Next() {
+		weapon, stats, err := scanPlayerWeapon(rows)
+		if err != nil {
+			return nil, err
+		}
+		weapons[weapon] = stats
+	}
+
+	return weapons, rows.Err()
+}
+
+func (s *sqlitedb) GetLeaderboard(filter LeaderboardFilter) ([]LeaderboardEntry, error) {
+	metric, ok := LeaderboardMetrics[filter.Metric]
+	if !ok {
+		return nil, errors.New("unknown leaderboard metric \"" + filter.Metric + "\"")
+	}
+
+	conditions, args := s.matchConditions(filter.matchFilter())
+	conditions = append([]string{`deleted = FALSE`}, conditions...)
+
+	if len(filter.SteamIds) != 0 {
+		for _, steamId := range filter.SteamIds {
+			args = append(args, strconv.FormatUint(steamId, 10))
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.SteamIds)), ", ")
+		conditions = append(conditions, `match_player_stats.steam_id IN (`+placeholders+`)`)
+	}
+
+	args = append(args, filter.MinMatches, filter.Limit)
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+
+	rows, err := s.db.
+		Query(
+			`SELECT
+			   match_player_stats.steam_id,
+			   `+latestPlayerNameQuery+`,
+			   COUNT(*),
+			   `+metric.valueExpr("REAL")+` AS value
+			 FROM match_player_stats
+			 JOIN matches ON matches.id = match_player_stats.match_id
+			 LEFT OUTER JOIN usermeta ON mapid = matches.id
+			 WHERE `+strings.Join(conditions, " AND ")+`
+			 GROUP BY match_player_stats.steam_id
+			 HAVING COUNT(*) >= ?
+			 ORDER BY value `+direction+`, match_player_stats.steam_id
+			 LIMIT ?`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]LeaderboardEntry, 0, filter.Limit)
+	for rows.Next() {
+		var steamId, name string
+		var entry LeaderboardEntry
+
+		err = rows.Scan(&steamId, &name, &entry.Matches, &entry.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.SteamId, err = strconv.ParseUint(steamId, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Name = name
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *sqlitedb) GetRatingMatches() ([]RatingMatch, error) {
+	rows, err := s.db.Query(ratingMatchesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make([]RatingMatch, 0)
+	for rows.Next() {
+		matches, err = scanRatingMatch(rows, matches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, rows.Err()
+}
+
+func (s *sqlitedb) GetRatingHistory(steamId uint64) ([]RatingChange, error) {
+	rows, err := s.db.Query(
+		`SELECT match_id, date, seq, rating_before, rating_after
+		 FROM rating_history
+		 WHERE steam_id = ?
+		 ORDER BY seq`,
+		strconv.FormatUint(steamId, 10),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]RatingChange, 0)
+	for rows.Next() {
+		change := RatingChange{SteamId: steamId}
+		err = rows.Scan(
+			&change.MatchId,
+			&change.Date,
+			&change.Seq,
+			&change.RatingBefore,
+			&change.RatingAfter,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *sqlitedb) GetRatings(steamIds []uint64) ([]PlayerRating, error) {
+	if len(steamIds) == 0 {
+		return []PlayerRating{}, nil
+	}
+
+	args := make([]interface{}, 0, len(steamIds))
+	for _, steamId := range steamIds {
+		args = append(args, strconv.FormatUint(steamId, 10))
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(steamIds)), ", ")
+	rows, err := s.db.Query(ratingsQuery+` AND rating.steam_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := make([]PlayerRating, 0, len(steamIds))
+	for rows.Next() {
+		rating, err := scanPlayerRating(rows)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+func (s *sqlitedb) GetMatchPositions(id string) ([]PositionEvent, error) {
+	var positionsJson string
+	err := s.db.
+		QueryRow(`SELECT positions FROM matches WHERE id = ? AND deleted = FALSE`, id).
+		Scan(&positionsJson)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	positions := make([]PositionEvent, 0)
+	err = json.Unmarshal([]byte(positionsJson), &positions)
+	if err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+func (s *sqlitedb) GetReplay(id string, round int) ([]ReplayFrame, error) {
+	var framesJson string
+	err := s.db.
+		QueryRow(
+			`SELECT frames
+			 FROM replays
+			 JOIN matches ON matches.id = replays.match_id
+			 WHERE replays.match_id = ? AND replays.round = ? AND matches.deleted = FALSE`,
+			id,
+			round,
+		).
+		Scan(&framesJson)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	frames := make([]ReplayFrame, 0)
+	err = json.Unmarshal([]byte(framesJson), &frames)
+	if err != nil {
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+func (s *sqlitedb) GetUtility(id string, round int) ([]Grenade, error) {
+	var grenadesJson string
+	err := s.db.
+		QueryRow(
+			`SELECT grenades
+			 FROM utility
+			 JOIN matches ON matches.id = utility.match_id
+			 WHERE utility.match_id = ? AND utility.round = ? AND matches.deleted = FALSE`,
+			id,
+			round,
+		).
+		Scan(&grenadesJson)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	grenades := make([]Grenade, 0)
+	err = json.Unmarshal([]byte(grenadesJson), &grenades)
+	if err != nil {
+		return nil, err
+	}
+
+	return grenades, nil
+}
+
+func (s *sqlitedb) GetUserMeta(id string) (*UserMeta, error) {
+	var demoLink *string
+	var dateTimestamp *int64
+
+	err := s.db.
+		QueryRow(`SELECT demo_link, date_override FROM usermeta WHERE mapid = ?`, id).
+		Scan(&demoLink, &dateTimestamp)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dateOverride int64 = 0
+	if dateTimestamp != nil {
+		dateOverride = *dateTimestamp
+	}
+
+	var demoLinkFinal string = ""
+	if demoLink != nil {
+		demoLinkFinal = *demoLink
+	}
+
+	return &UserMeta{
+		DemoLink:     demoLinkFinal,
+		DateOverride: dateOverride,
+	}, nil
+}
+
+func (s *sqlitedb) GetUser(username string) (*User, error) {
+	return s.getUser(username, nil)
+}
+
+func (s *sqlitedb) GetUsers() ([]User, error) {
+	query := `SELECT username, display_name, email, roles, steam_id FROM users`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0, 10)
+
+	for rows.Next() {
+		var username, displayName, email, rolesJson string
+		var steamId *string
+		var roles []string
+
+		err = rows.Scan(&username, &displayName, &email, &rolesJson, &steamId)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(rolesJson), &roles)
+		if err != nil {
+			return nil, err
+		}
+
+		finalSteamId := ""
+		if steamId != nil {
+			finalSteamId = *steamId
+		}
+
+		users = append(users,
+			User{
+				Username:    username,
+				DisplayName: displayName,
+				Email:       email,
+				Roles:       roles,
+				SteamId:     finalSteamId,
+			})
+	}
+
+	return users, rows.Err()
+}
+
+func (s *sqlitedb) GetAuditLog(limit, offset int) ([]AuditEntry, error) {
+	query := `SELECT
+				timestamp,
+				system,
+				username,
+				action,
+				description
+			  FROM auditlog
+			  ORDER BY timestamp DESC
+			  LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0, limit)
+
+	for rows.Next() {
+		var action, description string
+		var user *string
+		var timestamp int64
+		var system bool
+
+		err = rows.Scan(&timestamp, &system, &user, &action, &description)
+		if err != nil {
+			return nil, err
+		}
+
+		finalUser := ""
+		if user != nil {
+			finalUser = *user
+		}
+
+		entries = append(entries,
+			AuditEntry{
+				Timestamp:   timestamp,
+				System:      system,
+				Username:    finalUser,
+				Action:      action,
+				Description: description,
+			})
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *sqlitedb) GetJob(id string) (*Job, error) {
+	row := s.db.QueryRow(`SELECT `+jobColumns+` FROM parse_jobs WHERE id = ?`, id)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *sqlitedb) GetJobs(status string, limit, offset int) ([]Job, error) {
+	query := `SELECT ` + jobColumns + `
+			  FROM parse_jobs
+			  WHERE ?1 = '' OR status = ?1
+			  ORDER BY created_at DESC
+			  LIMIT ?2 OFFSET ?3`
+	rows, err := s.db.Query(query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0, limit)
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (s *sqlitedb) GetLatestJob(path string) (*Job, error) {
+	row := s.db.QueryRow(
+		`SELECT `+jobColumns+`
+		 FROM parse_jobs
+		 WHERE path = ?
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		path,
+	)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *sqlitedb) ClaimJob() (*Job, error) {
+	// SQLite only allows one writer at a time so the select and update
+	// can't be interleaved with another worker's
+	query := `UPDATE parse_jobs SET
+				status = ?,
+				attempts = attempts + 1,
+				updated_at = ?
+			  WHERE id = (
+				SELECT id FROM parse_jobs
+				WHERE status = ? AND retry_at <= ?
+				ORDER BY created_at
+				LIMIT 1
+			  )
+			  RETURNING ` + jobColumns
+
+	now := time.Now().UnixMilli()
+	row := s.db.QueryRow(query, JobRunning, now, JobQueued, now)
+
+	job, err := scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *sqlitedb) Login(username, password string) (*User, error) {
+	return s.getUser(username, &password)
+}
+
+func (s *sqlitedb) InvalidateToken(token string, expiry time.Time) error {
+	query := `INSERT INTO invalid_tokens (expiry, token) VALUES (?, ?)`
+	_, err := s.transactionExec(query, expiry.Unix(), token)
+	return err
+}
+
+func (s *sqlitedb) IsTokenValid(token string) (bool, error) {
+	var expiry int64
+
+	err := s.db.
+		QueryRow(`SELECT expiry FROM invalid_tokens WHERE token = ?`, token).
+		Scan(&expiry)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return time.Unix(expiry, 0).Before(time.Now()), nil
+}
+
+func (s *sqlitedb) CleanInvalidTokens() error {
+	now := time.Now().Unix()
+	_, err := s.transactionExec(`DELETE FROM invalid_tokens WHERE expiry < ?`, now)
+	return err
+}
+
+func (s *sqlitedb) RequeueRunningJobs() error {
+	_, err := s.transactionExec(
+		`UPDATE parse_jobs SET status = ?, updated_at = ? WHERE status = ?`,
+		JobQueued,
+		time.Now().UnixMilli(),
+		JobRunning,
+	)
+	return err
+}
+
+func (s *sqlitedb) CleanFinishedJobs(before int64) error {
+	_, err := s.transactionExec(
+		`DELETE FROM parse_jobs WHERE status IN (?, ?) AND updated_at < ?`,
+		JobDone,
+		JobFailed,
+		before,
+	)
+	return err
+}
+
+func (s *sqlitedb) RunMigration(config Config, dir string) error {
+	m, err := s.createMigrationClient(config)
+	if err != nil {
+		return err
+	}
+
+	if dir == "up" {
+		err = m.Up()
+	} else if dir == "down" {
+		err = m.Down()
+	} else {
+		err = errors.New("Invalid migration direction \"" + dir + "\"")
+	}
+
+	if err != nil && err.Error() != "no change" {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqlitedb) SoftDeleteMatch(id string) error {
+	_, err := s.transactionExec(
+		`UPDATE matches
+		 SET
+		   version = 0,
+		   deleted = TRUE,
+		   match_data = '{}',
+		   player_names = '{}',
+		   positions = '[]'
+	     WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.transactionExec(`DELETE FROM replays WHERE match_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.transactionExec(`DELETE FROM utility WHERE match_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.transactionExec(`DELETE FROM match_player_stats WHERE match_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.transactionExec(`DELETE FROM match_player_weapons WHERE match_id = ?`, id)
+	return err
+}
+
+func (s *sqlitedb) HardDeleteMatch(id string) error {
+	_, err := s.transactionExec(`DELETE FROM matches WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqlitedb) DeleteUser(username string) error {
+	_, err := s.transactionExec(`DELETE FROM users WHERE username = ?`, username)
+	return err
+}
+
+func (s *sqlitedb) Close() {
+	s.db.Close()
+}
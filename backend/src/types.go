@@ -19,8 +19,6 @@
 
 package main
 
-import "github.com/golang/geo/r2"
-
 type User struct {
 	Username    string   `json:"username"`
 	DisplayName string   `json:"displayName"`
@@ -56,73 +54,146 @@ type UserMeta struct {
 }
 
 type MetaData struct {
-	Map           string   `json:"map"`
-	Id            string   `json:"id"`
-	DateTimestamp int64    `json:"dateTimestamp"`
-	DemoType      string   `json:"demoType"`
-	PlayerNames   NamesMap `json:"playerNames"`
-	TeamAScore    int      `json:"teamAScore"`
-	TeamBScore    int      `json:"teamBScore"`
-	TeamATitle    string   `json:"teamATitle"`
-	TeamBTitle    string   `json:"teamBTitle"`
+	Map                string   `json:"map"`
+	Id                 string   `json:"id"`
+	DateTimestamp      int64    `json:"dateTimestamp"`
+	DateSource         string   `json:"dateSource"`
+	DemoType           string   `json:"demoType"`
+	DemoTypeConfidence float64  `json:"demoTypeConfidence"`
+	PlayerNames        NamesMap `json:"playerNames"`
+	TeamAScore         int      `json:"teamAScore"`
+	TeamBScore         int      `json:"teamBScore"`
+	TeamATitle         string   `json:"teamATitle"`
+	TeamBTitle         string   `json:"teamBTitle"`
+	// The index of the demo folder and the path relative to it. Only set
+	// when the match is parsed
+	DemoRoot int    `json:"-"`
+	DemoPath string `json:"-"`
+}
+
+// The date of a match as it was worked out when parsing, before any
+// user overrides
+type MatchDate struct {
+	Id            string
+	DateTimestamp int64
+	DateSource    string
+	DemoRoot      int
+	DemoPath      string
 }
 
 type Match struct {
-	Meta      MetaData              `json:"meta"`
-	MatchData MatchData             `json:"matchData"`
-	HeatMaps  map[string][]r2.Point `json:"heatmaps"`
+	Meta      MetaData        `json:"meta"`
+	MatchData MatchData       `json:"matchData"`
+	Positions []PositionEvent `json:"positions"`
+	// One list of frames per round
+	Replays [][]ReplayFrame `json:"replays"`
+	// One list of grenades per round
+	Utility [][]Grenade `json:"utility"`
 }
 
 type MatchData struct {
-	TotalRounds  int                     `json:"totalRounds"`
-	Teams        TeamsMap                `json:"teams"`
-	StartTeams   TeamsMap                `json:"startTeams"`
-	Rounds       []Round                 `json:"rounds"`
-	HalfLength   int                     `json:"halfLength"`
-	OpeningKills []OpeningKill           `json:"openingKills"`
-	HeadToHead   map[uint64]PlayerIntMap `json:"headToHead"`
-	KillFeed     KillFeed                `json:"killFeed"`
-	RoundByRound []RoundOverview         `json:"roundByRound"`
-	Stats        Stats                   `json:"stats"`
+	TotalRounds    int                     `json:"totalRounds"`
+	Teams          TeamsMap                `json:"teams"`
+	StartTeams     TeamsMap                `json:"startTeams"`
+	Rounds         []Round                 `json:"rounds"`
+	HalfLength     int                     `json:"halfLength"`
+	OvertimeLength int                     `json:"overtimeLength"`
+	Halves         []Half                  `json:"halves"`
+	OpeningKills   []OpeningKill           `json:"openingKills"`
+	HeadToHead     map[uint64]PlayerIntMap `json:"headToHead"`
+	KillFeed       KillFeed                `json:"killFeed"`
+	RoundByRound   []RoundOverview         `json:"roundByRound"`
+	Stats          Stats                   `json:"stats"`
 }
 
+// One half of regulation or overtime. OvertimeLength in MatchData is the
+// number of rounds in a whole overtime period (6 for MR3). Overtime is 0 for the regulation
+// halves and counts up from 1 for each overtime period. StartRound and
+// EndRound are indexes into the rounds list, EndRound being exclusive
+type Half struct {
+	Overtime   int    `json:"overtime"`
+	StartRound int    `json:"startRound"`
+	EndRound   int    `json:"endRound"`
+	TeamASide  string `json:"teamASide"`
+	TeamBSide  string `json:"teamBSide"`
+	TeamAScore int    `json:"teamAScore"`
+	TeamBScore int    `json:"teamBScore"`
+}
+
+// The db tags are the column names in the match_player_stats table
 type Stats struct {
-	Adr                PlayerF64Map `json:"adr"`
-	Assists            PlayerIntMap `json:"assists"`
-	Deaths             PlayerIntMap `json:"deaths"`
-	EFPerFlash         PlayerF64Map `json:"efPerFlash"`
-	EnemiesFlashed     PlayerIntMap `json:"enemiesFlashed"`
-	FlashAssists       PlayerIntMap `json:"flashAssists"`
-	FlashesThrown      PlayerIntMap `json:"flashesThrown"`
-	HEsThrown          PlayerIntMap `json:"HEsThrown"`
-	HeadshotPct        PlayerF64Map `json:"headshotPct"`
-	Hltv               PlayerF64Map `json:"hltv"`
-	Impact             PlayerF64Map `json:"impact"`
-	Kast               PlayerF64Map `json:"kast"`
-	Kd                 PlayerF64Map `json:"kd"`
-	Kdiff              PlayerIntMap `json:"kdiff"`
-	Kills              PlayerIntMap `json:"kills"`
-	Kpr                PlayerF64Map `json:"kpr"`
-	MolliesThrown      PlayerIntMap `json:"molliesThrown"`
-	OpeningAttempts    PlayerIntMap `json:"openingAttempts"`
-	OpeningAttemptsPct PlayerF64Map `json:"openingAttemptsPct"`
-	OpeningDeaths      PlayerIntMap `json:"openingDeaths"`
-	OpeningKills       PlayerIntMap `json:"openingKills"`
-	OpeningSuccess     PlayerF64Map `json:"openingSuccess"`
-	Rws                PlayerF64Map `json:"rws"`
-	SmokesThrown       PlayerIntMap `json:"smokesThrown"`
-	TeammatesFlashed   PlayerIntMap `json:"teammatesFlashed"`
-	DeathsTraded       PlayerIntMap `json:"deathsTraded"`
-	TradeKills         PlayerIntMap `json:"tradeKills"`
-	UtilDamage         PlayerIntMap `json:"utilDamage"`
+	Adr                PlayerF64Map `json:"adr" db:"adr"`
+	Assists            PlayerIntMap `json:"assists" db:"assists"`
+	Deaths             PlayerIntMap `json:"deaths" db:"deaths"`
+	EFPerFlash         PlayerF64Map `json:"efPerFlash" db:"ef_per_flash"`
+	EnemiesFlashed     PlayerIntMap `json:"enemiesFlashed" db:"enemies_flashed"`
+	FlashAssists       PlayerIntMap `json:"flashAssists" db:"flash_assists"`
+	FlashesThrown      PlayerIntMap `json:"flashesThrown" db:"flashes_thrown"`
+	HEsThrown          PlayerIntMap `json:"HEsThrown" db:"hes_thrown"`
+	HeadshotPct        PlayerF64Map `json:"headshotPct" db:"headshot_pct"`
+	Hltv               PlayerF64Map `json:"hltv" db:"hltv"`
+	Impact             PlayerF64Map `json:"impact" db:"impact"`
+	Kast               PlayerF64Map `json:"kast" db:"kast"`
+	Kd                 PlayerF64Map `json:"kd" db:"kd"`
+	Kdiff              PlayerIntMap `json:"kdiff" db:"kdiff"`
+	Kills              PlayerIntMap `json:"kills" db:"kills"`
+	Kpr                PlayerF64Map `json:"kpr" db:"kpr"`
+	MolliesThrown      PlayerIntMap `json:"molliesThrown" db:"mollies_thrown"`
+	OpeningAttempts    PlayerIntMap `json:"openingAttempts" db:"opening_attempts"`
+	OpeningAttemptsPct PlayerF64Map `json:"openingAttemptsPct" db:"opening_attempts_pct"`
+	OpeningDeaths      PlayerIntMap `json:"openingDeaths" db:"opening_deaths"`
+	OpeningKills       PlayerIntMap `json:"openingKills" db:"opening_kills"`
+	OpeningSuccess     PlayerF64Map `json:"openingSuccess" db:"opening_success"`
+	Rws                PlayerF64Map `json:"rws" db:"rws"`
+	SmokesThrown       PlayerIntMap `json:"smokesThrown" db:"smokes_thrown"`
+	TeammatesFlashed   PlayerIntMap `json:"teammatesFlashed" db:"teammates_flashed"`
+	DeathsTraded       PlayerIntMap `json:"deathsTraded" db:"deaths_traded"`
+	TradeKills         PlayerIntMap `json:"tradeKills" db:"trade_kills"`
+	UtilDamage         PlayerIntMap `json:"utilDamage" db:"util_damage"`
+
+	// Failed trades are the times a teammate died close by and the player
+	// didn't trade them. Time to trade is the average number of seconds
+	// between the teammate dying and the player getting the trade kill
+	FailedTrades PlayerIntMap `json:"failedTrades" db:"failed_trades"`
+	TimeToTrade  PlayerF64Map `json:"timeToTrade" db:"time_to_trade"`
+
+	ClutchAttempts    PlayerIntMap `json:"clutchAttempts" db:"clutch_attempts"`
+	ClutchWins        PlayerIntMap `json:"clutchWins" db:"clutch_wins"`
+	Clutch1v1Attempts PlayerIntMap `json:"clutch1v1Attempts" db:"clutch_1v1_attempts"`
+	Clutch1v1Wins     PlayerIntMap `json:"clutch1v1Wins" db:"clutch_1v1_wins"`
+	Clutch1v2Attempts PlayerIntMap `json:"clutch1v2Attempts" db:"clutch_1v2_attempts"`
+	Clutch1v2Wins     PlayerIntMap `json:"clutch1v2Wins" db:"clutch_1v2_wins"`
+	Clutch1v3Attempts PlayerIntMap `json:"clutch1v3Attempts" db:"clutch_1v3_attempts"`
+	Clutch1v3Wins     PlayerIntMap `json:"clutch1v3Wins" db:"clutch_1v3_wins"`
+	Clutch1v4Attempts PlayerIntMap `json:"clutch1v4Attempts" db:"clutch_1v4_attempts"`
+	Clutch1v4Wins     PlayerIntMap `json:"clutch1v4Wins" db:"clutch_1v4_wins"`
+	Clutch1v5Attempts PlayerIntMap `json:"clutch1v5Attempts" db:"clutch_1v5_attempts"`
+	Clutch1v5Wins     PlayerIntMap `json:"clutch1v5Wins" db:"clutch_1v5_wins"`
 
 	// Can't name these 2k, 3k etc because identifiers can't start with
 	// numbers in Go
 	// "lul" - Tom
-	K2 PlayerIntMap `json:"2k"`
-	K3 PlayerIntMap `json:"3k"`
-	K4 PlayerIntMap `json:"4k"`
-	K5 PlayerIntMap `json:"5k"`
+	K2 PlayerIntMap `json:"2k" db:"k2"`
+	K3 PlayerIntMap `json:"3k" db:"k3"`
+	K4 PlayerIntMap `json:"4k" db:"k4"`
+	K5 PlayerIntMap `json:"5k" db:"k5"`
+
+	// Accuracy only counts guns. The first shot is the first bullet of
+	// each spray
+	ShotsFired        PlayerIntMap `json:"shotsFired" db:"shots_fired"`
+	ShotsHit          PlayerIntMap `json:"shotsHit" db:"shots_hit"`
+	Accuracy          PlayerF64Map `json:"accuracy" db:"accuracy"`
+	FirstShotsFired   PlayerIntMap `json:"firstShotsFired" db:"first_shots_fired"`
+	FirstShotsHit     PlayerIntMap `json:"firstShotsHit" db:"first_shots_hit"`
+	FirstShotAccuracy PlayerF64Map `json:"firstShotAccuracy" db:"first_shot_accuracy"`
+	HeadHits          PlayerIntMap `json:"headHits" db:"head_hits"`
+	ChestHits         PlayerIntMap `json:"chestHits" db:"chest_hits"`
+	StomachHits       PlayerIntMap `json:"stomachHits" db:"stomach_hits"`
+	ArmHits           PlayerIntMap `json:"armHits" db:"arm_hits"`
+	LegHits           PlayerIntMap `json:"legHits" db:"leg_hits"`
+
+	// Not stored in match_player_stats since it's also keyed by weapon
+	Weapons PlayerWeaponMap `json:"weapons"`
 }
 
 type Round struct {
@@ -133,6 +204,24 @@ type Round struct {
 	PlanterTime     int64  `json:"planterTime"`
 	DefuserTime     int64  `json:"defuserTime"`
 	BombExplodeTime int64  `json:"bombExplodeTime"`
+
+	CTEconomy TeamEconomy `json:"ctEconomy"`
+	TEconomy  TeamEconomy `json:"tEconomy"`
+}
+
+// Team-wide money information, captured when the freeze time ends
+type TeamEconomy struct {
+	NumPlayers     int    `json:"numPlayers"`
+	StartMoney     int    `json:"startMoney"`
+	EquipmentValue int    `json:"equipmentValue"`
+	MoneySpent     int    `json:"moneySpent"`
+	BuyType        string `json:"buyType"`
+}
+
+type PlayerEconomy struct {
+	StartMoney     int `json:"startMoney"`
+	EquipmentValue int `json:"equipmentValue"`
+	MoneySpent     int `json:"moneySpent"`
 }
 
 type Kill struct {
@@ -149,9 +238,63 @@ type Kill struct {
 	VictimLocation    string `json:"victimLocation"`
 }
 
-type Death struct {
-	KilledBy    uint64  `json:"killedBy,string"`
-	TimeOfDeath float64 `json:"timeOfDeath"`
+const (
+	PositionShot    = "shot"
+	PositionKill    = "kill"
+	PositionDeath   = "death"
+	PositionGrenade = "grenade"
+	PositionPlant   = "plant"
+)
+
+// Something that happened at a specific spot on the map. The coordinates
+// have already been translated to match the radar overview image
+type PositionEvent struct {
+	Kind string `json:"kind"`
+	// Round number, starting at 1
+	Round  int     `json:"round"`
+	Player uint64  `json:"player,string"`
+	Side   string  `json:"side"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+}
+
+// Which position events to include in a heatmap. Zero values mean the
+// filter isn't applied. Round numbers start at 1 and are inclusive
+type HeatmapFilter struct {
+	Kind      string
+	Player    uint64
+	Side      string
+	FromRound int
+	ToRound   int
+}
+
+// A snapshot of every living player during a round, used for 2D replays
+type ReplayFrame struct {
+	// milliseconds since the start of the round
+	Time    int64          `json:"t"`
+	Players []ReplayPlayer `json:"p"`
+}
+
+// There are a lot of these per round so the JSON keys are kept short.
+// Coordinates are in radar image pixels and the yaw is in degrees
+type ReplayPlayer struct {
+	Id     uint64 `json:"id,string"`
+	Side   string `json:"s"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Yaw    int    `json:"r"`
+	Health int    `json:"hp"`
+	Weapon string `json:"w"`
+}
+
+// A player left alone against one or more enemies. Only the first
+// player to end up in this situation in a round gets credited with it
+type Clutch struct {
+	Player    uint64 `json:"player,string"`
+	Side      string `json:"side"`
+	Opponents int    `json:"opponents"`
+	Time      int64  `json:"time"`
+	Won       bool   `json:"won"`
 }
 
 type RoundEvent struct {
@@ -168,6 +311,13 @@ type RoundEvent struct {
 
 	// kind == defuse
 	Defuser uint64 `json:"defuser,omitempty,string"`
+
+	// kind == trade: Killer killed Victim after Victim killed Traded
+	// kind == failed_trade: Player was near Traded when Killer killed
+	// them but nobody traded the kill
+	Traded      uint64 `json:"traded,omitempty,string"`
+	TimeToTrade int64  `json:"timeToTrade,omitempty"`
+	Player      uint64 `json:"player,omitempty,string"`
 }
 
 type RoundOverview struct {
@@ -176,4 +326,164 @@ type RoundOverview struct {
 	TeamASide  string       `json:"teamASide"`
 	TeamBSide  string       `json:"teamBSide"`
 	Events     []RoundEvent `json:"events"`
+
+	TeamAEconomy TeamEconomy              `json:"teamAEconomy"`
+	TeamBEconomy TeamEconomy              `json:"teamBEconomy"`
+	Economy      map[uint64]PlayerEconomy `json:"economy"`
+
+	Clutch *Clutch `json:"clutch,omitempty"`
+}
+
+const (
+	MatchSortDate   = "date"
+	MatchSortMap    = "map"
+	MatchSortRounds = "rounds"
+)
+
+// Filters and sort order for the match history. Zero values mean the
+// filter isn't applied
+type MatchFilter struct {
+	Map      string
+	DemoType string
+	// unix millis, inclusive
+	From int64
+	To   int64
+	// Either team's title, case insensitive
+	Team    string
+	SteamId uint64
+	// Final score, regardless of which team won. Only applied if
+	// HasScore is set since 0 is a valid score
+	HasScore  bool
+	HighScore int
+	LowScore  int
+
+	// One of the MatchSort constants, defaults to date
+	Sort      string
+	Ascending bool
+}
+
+// Filters used when aggregating player stats across matches. Zero values
+// mean the filter isn't applied
+type PlayerFilter struct {
+	SteamId  uint64
+	From     int64
+	To       int64
+	Map      string
+	DemoType string
+}
+
+func (f PlayerFilter) matchFilter() MatchFilter {
+	return MatchFilter{
+		SteamId:  f.SteamId,
+		From:     f.From,
+		To:       f.To,
+		Map:      f.Map,
+		DemoType: f.DemoType,
+	}
+}
+
+type LeaderboardFilter struct {
+	// The JSON name of the Stats field to rank by
+	Metric     string
+	MinMatches int
+	Limit      int
+	Ascending  bool
+	From       int64
+	To         int64
+	Map        string
+	DemoType   string
+	// Only rank these players if set
+	SteamIds []uint64
+}
+
+func (f LeaderboardFilter) matchFilter() MatchFilter {
+	return MatchFilter{
+		From:     f.From,
+		To:       f.To,
+		Map:      f.Map,
+		DemoType: f.DemoType,
+	}
+}
+
+type LeaderboardEntry struct {
+	Rank    int     `json:"rank"`
+	SteamId uint64  `json:"steamId,string"`
+	Name    string  `json:"name"`
+	Matches int     `json:"matches"`
+	Value   float64 `json:"value"`
+}
+
+type Leaderboard struct {
+	Metric string `json:"metric"`
+	// Either average (weighted by rounds played) or total
+	Aggregate string             `json:"aggregate"`
+	Entries   []LeaderboardEntry `json:"entries"`
+}
+
+// Stats for a player aggregated over any number of matches. Per-round
+// stats are weighted by the number of rounds played in each match
+type CareerStats struct {
+	Matches int `json:"matches"`
+	Wins    int `json:"wins"`
+	Losses  int `json:"losses"`
+	Ties    int `json:"ties"`
+	Rounds  int `json:"rounds"`
+
+	Kills          int     `json:"kills"`
+	Deaths         int     `json:"deaths"`
+	Assists        int     `json:"assists"`
+	Kdiff          int     `json:"kdiff"`
+	Kd             float64 `json:"kd"`
+	Kpr            float64 `json:"kpr"`
+	Adr            float64 `json:"adr"`
+	Hltv           float64 `json:"hltv"`
+	Impact         float64 `json:"impact"`
+	Kast           float64 `json:"kast"`
+	HeadshotPct    float64 `json:"headshotPct"`
+	Rws            float64 `json:"rws"`
+	OpeningKills   int     `json:"openingKills"`
+	OpeningDeaths  int     `json:"openingDeaths"`
+	TradeKills     int     `json:"tradeKills"`
+	DeathsTraded   int     `json:"deathsTraded"`
+	ClutchAttempts int     `json:"clutchAttempts"`
+	ClutchWins     int     `json:"clutchWins"`
+	UtilDamage     int     `json:"utilDamage"`
+	FlashAssists   int     `json:"flashAssists"`
+	EnemiesFlashed int     `json:"enemiesFlashed"`
+
+	ShotsFired        int     `json:"shotsFired"`
+	ShotsHit          int     `json:"shotsHit"`
+	Accuracy          float64 `json:"accuracy"`
+	FirstShotAccuracy float64 `json:"firstShotAccuracy"`
+
+	K2 int `json:"2k"`
+	K3 int `json:"3k"`
+	K4 int `json:"4k"`
+	K5 int `json:"5k"`
+}
+
+type PlayerSummary struct {
+	SteamId    uint64      `json:"steamId,string"`
+	Name       string      `json:"name"`
+	LastPlayed int64       `json:"lastPlayed"`
+	Stats      CareerStats `json:"stats"`
+}
+
+// A single match from the point of view of one player
+type PlayerMatchSummary struct {
+	Meta    MetaData `json:"meta"`
+	Result  string   `json:"result"`
+	Kills   int      `json:"kills"`
+	Deaths  int      `json:"deaths"`
+	Assists int      `json:"assists"`
+	Adr     float64  `json:"adr"`
+	Hltv    float64  `json:"hltv"`
+	Kast    float64  `json:"kast"`
+}
+
+type PlayerProfile struct {
+	PlayerSummary
+	Maps    map[string]CareerStats `json:"maps"`
+	Weapons map[string]WeaponStats `json:"weapons"`
+	Matches []PlayerMatchSummary   `json:"matches"`
 }
@@ -20,13 +20,11 @@
 package main
 
 import (
+	"errors"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
-	"time"
 
-	dem "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs"
 	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
 )
 
@@ -141,7 +139,22 @@ func getPlayers(teams TeamsMap, playerNames NamesMap, hltv PlayerF64Map, side st
 	return ret
 }
 
-func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, string) {
+// Whether the teams swap sides after the given round (1-indexed). Teams
+// swap at halftime and at the halftime of every overtime period. They keep
+// their sides going into overtime and from one overtime period to the next
+func sideSwitchAfter(round, halfLength, overtimeLength int) bool {
+	if round == halfLength {
+		return true
+	}
+
+	if round <= halfLength*2 || overtimeLength <= 0 {
+		return false
+	}
+
+	return (round-halfLength*2)%overtimeLength == overtimeLength/2
+}
+
+func getScore(rounds []Round, endSide string, toRound, halfLength, overtimeLength int) (int, string) {
 	score := 0
 	currSide := endSide
 	roundSide := ""
@@ -152,11 +165,7 @@ func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, str
 		round := rounds[i-1]
 
 		// Switch sides at half time and during overtime
-		//
-		// We will assume that overtime for short matches is 3 rounds per half,
-		// I've never actually seen a short match with overtime so who knows if this
-		// condition will ever even be triggered
-		if i == halfLength || (i > halfLength*2 && (i-3)%6 == 0) {
+		if sideSwitchAfter(i, halfLength, overtimeLength) {
 			if currSide == "T" {
 				currSide = "CT"
 			} else {
@@ -179,59 +188,37 @@ func getScore(rounds []Round, endSide string, toRound, halfLength int) (int, str
 	return score, roundSide
 }
 
-func getDemoFileName(path string) string {
-	return strings.Replace(path[strings.LastIndex(path, "/")+1:], ".dem", "", 1)
-}
-
-func getDemoType(demoFileName string) string {
-	if strings.HasPrefix(demoFileName, "esea") {
-		return "esea"
-	} else if strings.HasPrefix(demoFileName, "pug_") {
-		return "pugsetup"
-	} else if strings.HasPrefix(demoFileName, "1-") {
-		return "faceit"
-	} else {
-		return "steam"
+// Strip any directories from the name of an uploaded demo and replace
+// characters that could cause problems on disk or in URLs
+func sanitizeDemoFileName(name string) (string, error) {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if !strings.HasSuffix(name, ".dem") {
+		return "", errors.New("demo file name must end in .dem")
 	}
-}
-
-var (
-	DateRegex1 = regexp.MustCompile(`(\d\d\d\d)-(\d\d)-(\d\d)`)
-	DateRegex2 = regexp.MustCompile(`(\d\d\d\d)_(\d\d)_(\d\d)`)
-	DateRegex3 = regexp.MustCompile(`(\d\d\d\d)/(\d\d)/(\d\d)`)
-)
-
-func getDemoTime(config Config, logger *Logger, demoFileName string) time.Time {
-	matches := DateRegex1.FindStringSubmatch(demoFileName)
-	if matches == nil {
-		matches = DateRegex2.FindStringSubmatch(demoFileName)
-	}
-
-	if matches == nil {
-		matches = DateRegex3.FindStringSubmatch(demoFileName)
-	}
-
-	defaultTime := time.Now()
-	if matches != nil {
-		// TODO: should probably come back to this and be a
-		// little smarter about which matched field is the day
-		// and which is the month
-		loc, err := time.LoadLocation(config.timezone)
-		if err != nil {
-			logger.Errorf("failed to load timezone: %s", err.Error())
-			return defaultTime
-		}
 
-		time, err := time.ParseInLocation("2006-01-02", matches[1]+"-"+matches[2]+"-"+matches[3], loc)
-		if err != nil {
-			logger.Errorf("failed to parse time: %s", err.Error())
-			return defaultTime
+	base := strings.TrimSuffix(name, ".dem")
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') ||
+			r == '-' || r == '_' || r == '.' {
+			return r
 		}
+		return '_'
+	}, base)
 
-		return time
+	if sanitized == "" || strings.HasPrefix(sanitized, ".") {
+		return "", errors.New("invalid demo file name")
 	}
 
-	return defaultTime
+	return sanitized + ".dem", nil
+}
+
+// The match ID for a demo. Compression extensions are ignored so that
+// compressing a demo doesn't change its ID
+func getDemoFileName(path string) string {
+	name, _ := trimCompressionExt(path[strings.LastIndex(path, "/")+1:])
+	return strings.Replace(name, ".dem", "", 1)
 }
 
 func getTeamName(
@@ -288,55 +275,6 @@ Outer:
 	}
 }
 
-func updateTeams(
-	p *dem.Parser,
-	teams *TeamsMap,
-	ctClanTag, tClanTag *string,
-	leavers map[uint64]uint64,
-) {
-	// If the teams have custom names we will use those
-	tTag := (*p).GameState().TeamTerrorists().ClanName()
-	ctTag := (*p).GameState().TeamCounterTerrorists().ClanName()
-
-	if tTag != "" && ctTag != "" {
-		*tClanTag = tTag
-		*ctClanTag = ctTag
-	}
-
-	for _, player := range (*p).GameState().Participants().All() {
-		if !player.IsConnected {
-			continue
-		}
-
-		playerId := unBotify(player.SteamID64)
-
-		switch player.Team {
-		case common.TeamSpectators:
-			delete(*teams, playerId)
-		case common.TeamUnassigned:
-			delete(*teams, playerId)
-		case common.TeamCounterTerrorists:
-			(*teams)[playerId] = "CT"
-		case common.TeamTerrorists:
-			(*teams)[playerId] = "T"
-		}
-	}
-
-	for leaver, teammate := range leavers {
-		(*teams)[unBotify(leaver)] = (*teams)[unBotify(teammate)]
-	}
-}
-
-func updatePlayerNames(p *dem.Parser, playerNames *NamesMap) {
-	for _, player := range (*p).GameState().Participants().Playing() {
-		if player.IsBot {
-			(*playerNames)[unBotify(player.SteamID64)] = "BOT " + player.Name
-		} else {
-			(*playerNames)[unBotify(player.SteamID64)] = player.Name
-		}
-	}
-}
-
 func getWeaponFileName(weapon common.EquipmentType) string {
 	switch weapon {
 	case common.EqP2000:
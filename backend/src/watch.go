@@ -20,6 +20,9 @@
 package main
 
 import (
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -30,7 +33,37 @@ type FileRename struct {
 	old, new string
 }
 
-func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- FileRename, logger *Logger) error {
+// Watch the folder and all of its subfolders. Hidden folders are skipped
+// like they are when scanning for demos. Adding a folder that is already
+// being watched just updates its path, which is what we want when it has
+// been renamed
+func watchRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Watch the demo folders for new and renamed demos. New folders are sent
+// to newFile as well so that any demos that were in them before we started
+// watching them get picked up
+func watchDemoDirs(watchDirs []string, newFile chan<- string, renamedFile chan<- FileRename, logger *Logger) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		logger.Error(err)
@@ -52,14 +85,37 @@ func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- Fil
 				}
 
 				path := event.Name
-				if !strings.HasSuffix(path, ".dem") {
+
+				// The old name of a renamed folder isn't a demo so we
+				// have to hang on to every rename
+				if event.Op&fsnotify.Rename == fsnotify.Rename {
+					prev = &event
+					continue
+				}
+
+				dir := event.Op&fsnotify.Create == fsnotify.Create && isDir(path)
+				if dir {
+					if strings.HasPrefix(filepath.Base(path), ".") {
+						continue
+					}
+
+					err := watchRecursive(watcher, path)
+					if err != nil {
+						logger.Errorf("failed to watch folder %s: %s", path, err.Error())
+					}
+				} else if !isDemoSource(path) {
 					continue
 				}
 
 				if event.Op&fsnotify.Create == fsnotify.Create ||
 					event.Op&fsnotify.Write == fsnotify.Write {
 
-					if prev != nil && prev.Op&fsnotify.Rename == fsnotify.Rename {
+					// Files that are renamed to a demo from something that
+					// wasn't a demo are new demos. Uploads are linked into
+					// place from their temporary file, which only shows up
+					// as a create
+					renamed := prev != nil && prev.Op&fsnotify.Rename == fsnotify.Rename
+					if renamed && (dir || isDemoSource(prev.Name)) {
 						renamedFile <- FileRename{old: prev.Name, new: path}
 					} else {
 						// only send to the channel after we have stopped receiving
@@ -88,9 +144,11 @@ func watchDemoDir(watchDir string, newFile chan<- string, renamedFile chan<- Fil
 		}
 	}()
 
-	err = watcher.Add(watchDir)
-	if err != nil {
-		logger.Error(err)
+	for _, watchDir := range watchDirs {
+		err = watchRecursive(watcher, watchDir)
+		if err != nil {
+			logger.Error(err)
+		}
 	}
 
 	<-done
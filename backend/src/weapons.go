@@ -0,0 +1,239 @@
+/*
+ * Copyright 2022 Puggies Authors (see AUTHORS.txt)
+ *
+ * This file is part of Puggies.
+ *
+ * Puggies is free software: you can redistribute it and/or modify it under
+ * the terms of the GNU Affero General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * Puggies is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+ * FITNESS FOR A PARTICULAR PURPOSE. See the GNU Affero General Public
+ * License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Puggies. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"math"
+
+	"github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/common"
+	events "github.com/markus-wa/demoinfocs-golang/v2/pkg/demoinfocs/events"
+)
+
+const (
+	// A shot counts as the first bullet of a spray if the player hasn't
+	// fired the same weapon for this long. Recoil has mostly reset by then
+	FirstShotResetMs = 500
+
+	// Only CS2 has a separate neck hitgroup so demoinfocs v2 doesn't
+	// have a constant for it
+	HitGroupNeck events.HitGroup = 8
+)
+
+type WeaponStats struct {
+	Kills     int `json:"kills"`
+	Headshots int `json:"headshots"`
+	// Health damage dealt to enemies
+	Damage int `json:"damage"`
+	// Only counted for guns. Grenades and knives don't have shots
+	Shots int `json:"shots"`
+	// Shots that hit an enemy. Shotgun pellets that hit the same player
+	// count as one hit
+	Hits int `json:"hits"`
+	// The first bullet of each spray and whether it hit
+	FirstShots    int `json:"firstShots"`
+	FirstShotHits int `json:"firstShotHits"`
+
+	// Where the hits landed. Hits on the generic hitgroup and on gear
+	// aren't counted here
+	HeadHits    int `json:"headHits"`
+	ChestHits   int `json:"chestHits"`
+	StomachHits int `json:"stomachHits"`
+	ArmHits     int `json:"armHits"`
+	LegHits     int `json:"legHits"`
+
+	Accuracy          float64 `json:"accuracy"`
+	FirstShotAccuracy float64 `json:"firstShotAccuracy"`
+	HeadshotPct       float64 `json:"headshotPct"`
+}
+
+// Weapon stats for each player, keyed by the name of the weapon
+type PlayerWeaponMap map[uint64]map[string]WeaponStats
+
+// The last enemy a player hit, used to avoid counting every shotgun
+// pellet as a separate hit
+type weaponHit struct {
+	victim uint64
+	weapon common.EquipmentType
+	time   int64
+}
+
+// The last shot a player fired
+type weaponShot struct {
+	weapon common.EquipmentType
+	time   int64
+	// Whether this was the first bullet of a spray that hasn't hit
+	// anyone yet
+	first bool
+}
+
+func isGun(weapon common.EquipmentType) bool {
+	switch weapon.Class() {
+	case common.EqClassPistols, common.EqClassSMG, common.EqClassHeavy, common.EqClassRifle:
+		return true
+	}
+	return false
+}
+
+func (w *WeaponStats) addHitGroup(hitGroup int) {
+	switch events.HitGroup(hitGroup) {
+	// Neck hits do headshot damage
+	case events.HitGroupHead, HitGroupNeck:
+		w.HeadHits += 1
+	case events.HitGroupChest:
+		w.ChestHits += 1
+	case events.HitGroupStomach:
+		w.StomachHits += 1
+	case events.HitGroupLeftArm, events.HitGroupRightArm:
+		w.ArmHits += 1
+	case events.HitGroupLeftLeg, events.HitGroupRightLeg:
+		w.LegHits += 1
+	}
+}
+
+func (m PlayerWeaponMap) update(player uint64, weapon common.EquipmentType, f func(*WeaponStats)) {
+	if weapon == common.EqUnknown {
+		return
+	}
+
+	if m[player] == nil {
+		m[player] = make(map[string]WeaponStats)
+	}
+
+	stats := m[player][weapon.String()]
+	f(&stats)
+	m[player][weapon.String()] = stats
+}
+
+func (w WeaponStats) add(other WeaponStats) WeaponStats {
+	w.Kills += other.Kills
+	w.Headshots += other.Headshots
+	w.Damage += other.Damage
+	w.Shots += other.Shots
+	w.Hits += other.Hits
+	w.FirstShots += other.FirstShots
+	w.FirstShotHits += other.FirstShotHits
+	w.HeadHits += other.HeadHits
+	w.ChestHits += other.ChestHits
+	w.StomachHits += other.StomachHits
+	w.ArmHits += other.ArmHits
+	w.LegHits += other.LegHits
+	return w
+}
+
+// Fill in the percentages once all of the totals have been added up
+func (w WeaponStats) finish() WeaponStats {
+	w.Accuracy = 0
+	w.FirstShotAccuracy = 0
+	w.HeadshotPct = 0
+
+	if w.Shots != 0 {
+		w.Accuracy = math.Round(float64(w.Hits) / float64(w.Shots) * 100)
+	}
+
+	if w.FirstShots != 0 {
+		w.FirstShotAccuracy = math.Round(float64(w.FirstShotHits) / float64(w.FirstShots) * 100)
+	}
+
+	if w.Kills != 0 {
+		w.HeadshotPct = math.Round(float64(w.Headshots) / float64(w.Kills) * 100)
+	}
+
+	return w
+}
+
+func finishWeaponStats(weapons map[string]WeaponStats) map[string]WeaponStats {
+	for weapon, stats := range weapons {
+		weapons[weapon] = stats.finish()
+	}
+	return weapons
+}
+
+func computeWeaponStats(rounds []PlayerWeaponMap) PlayerWeaponMap {
+	ret := make(PlayerWeaponMap)
+	for _, round := range rounds {
+		for player, weapons := range round {
+			if ret[player] == nil {
+				ret[player] = make(map[string]WeaponStats)
+			}
+
+			for weapon, stats := range weapons {
+				ret[player][weapon] = ret[player][weapon].add(stats)
+			}
+		}
+	}
+
+	for _, weapons := range ret {
+		finishWeaponStats(weapons)
+	}
+
+	return ret
+}
+
+// Accuracy over all of the guns each player used. Returns shotsFired,
+// shotsHit, accuracy, firstShotsFired, firstShotsHit, firstShotAccuracy
+func computeAccuracy(weapons PlayerWeaponMap) (
+	PlayerIntMap, PlayerIntMap, PlayerF64Map,
+	PlayerIntMap, PlayerIntMap, PlayerF64Map,
+) {
+	shotsFired := make(PlayerIntMap)
+	shotsHit := make(PlayerIntMap)
+	accuracy := make(PlayerF64Map)
+	firstShotsFired := make(PlayerIntMap)
+	firstShotsHit := make(PlayerIntMap)
+	firstShotAccuracy := make(PlayerF64Map)
+
+	for player, playerWeapons := range weapons {
+		total := WeaponStats{}
+		for _, stats := range playerWeapons {
+			total = total.add(stats)
+		}
+		total = total.finish()
+
+		shotsFired[player] = total.Shots
+		shotsHit[player] = total.Hits
+		accuracy[player] = total.Accuracy
+		firstShotsFired[player] = total.FirstShots
+		firstShotsHit[player] = total.FirstShotHits
+		firstShotAccuracy[player] = total.FirstShotAccuracy
+	}
+
+	return shotsFired, shotsHit, accuracy, firstShotsFired, firstShotsHit, firstShotAccuracy
+}
+
+// returns headHits, chestHits, stomachHits, armHits, legHits
+func computeHitGroups(weapons PlayerWeaponMap) (PlayerIntMap, PlayerIntMap, PlayerIntMap, PlayerIntMap, PlayerIntMap) {
+	head := make(PlayerIntMap)
+	chest := make(PlayerIntMap)
+	stomach := make(PlayerIntMap)
+	arms := make(PlayerIntMap)
+	legs := make(PlayerIntMap)
+
+	for player, playerWeapons := range weapons {
+		for _, stats := range playerWeapons {
+			head[player] += stats.HeadHits
+			chest[player] += stats.ChestHits
+			stomach[player] += stats.StomachHits
+			arms[player] += stats.ArmHits
+			legs[player] += stats.LegHits
+		}
+	}
+
+	return head, chest, stomach, arms, legs
+}
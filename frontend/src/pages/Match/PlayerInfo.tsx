@@ -110,12 +110,16 @@ const KillsVisualization = (props: {
   player: string;
   startSide: Team;
   halfLength: number;
+  overtimeLength: number;
 }) => {
-  const halfLength = props.halfLength;
+  const { halfLength, overtimeLength } = props;
+  const otHalf = overtimeLength / 2;
   const overtimes =
     props.killFeed.length > halfLength * 2
       ? Array.from(
-          Array(Math.ceil((props.killFeed.length - halfLength * 2) / 6)).keys()
+          Array(
+            Math.ceil((props.killFeed.length - halfLength * 2) / overtimeLength)
+          ).keys()
         )
       : [];
 
@@ -143,7 +147,7 @@ const KillsVisualization = (props: {
       />
       {overtimes
         .map((ot) => {
-          const i = halfLength * 2 + ot * 6;
+          const i = halfLength * 2 + ot * overtimeLength;
           const side =
             ot % 2 === 0 ? INVERT_TEAM[props.startSide] : props.startSide;
 
@@ -154,7 +158,7 @@ const KillsVisualization = (props: {
               killFeed={props.killFeed}
               player={props.player}
               side={side}
-              rounds={[i, i + 3]}
+              rounds={[i, i + otHalf]}
               styles={{ mr: 1 }}
             />,
             <KillGridHalf
@@ -162,7 +166,7 @@ const KillsVisualization = (props: {
               killFeed={props.killFeed}
               player={props.player}
               side={INVERT_TEAM[side]}
-              rounds={[i + 3, i + 6]}
+              rounds={[i + otHalf, i + overtimeLength]}
             />,
           ];
         })
@@ -230,6 +234,7 @@ export const PlayerInfo = (props: {
             player={selectedPlayer}
             startSide={props.match.matchData.startTeams[selectedPlayer]}
             halfLength={props.match.matchData.halfLength}
+            overtimeLength={props.match.matchData.overtimeLength}
           />
         </>
       )}
@@ -59,7 +59,8 @@ type KillFeedThing = {
 const playerColor = (
   startTeam: Team | undefined,
   round: number,
-  halfLength: number
+  halfLength: number,
+  overtimeLength: number
 ) => {
   if (startTeam === undefined) return "white";
 
@@ -68,13 +69,16 @@ const playerColor = (
   } else if (round <= halfLength * 2) {
     return KILLFEED_COLORS_MAP[INVERT_TEAM[startTeam]];
   } else {
-    const ot = Math.ceil((round - halfLength * 2) / 6);
-    const otRound = ((round - 1) % 6) + 1;
+    const otRounds = round - halfLength * 2;
+    const ot = Math.ceil(otRounds / overtimeLength);
+    const otRound = ((otRounds - 1) % overtimeLength) + 1;
     let side;
     if (ot % 2 === 0) {
-      side = otRound <= 3 ? startTeam : INVERT_TEAM[startTeam];
+      side =
+        otRound <= overtimeLength / 2 ? startTeam : INVERT_TEAM[startTeam];
     } else {
-      side = otRound <= 3 ? INVERT_TEAM[startTeam] : startTeam;
+      side =
+        otRound <= overtimeLength / 2 ? INVERT_TEAM[startTeam] : startTeam;
     }
     return KILLFEED_COLORS_MAP[side];
   }
@@ -127,6 +131,8 @@ const KillFeedItem = (
     startTeams: TeamsMap;
     playerNames: PlayerNames;
     halfLength: number;
+  overtimeLength: number;
+    overtimeLength: number;
   }
 ) => {
   const { kill, round, startTeams, playerNames } = props;
@@ -138,7 +144,8 @@ const KillFeedItem = (
         color={playerColor(
           startTeams[props.killer.toString()],
           round,
-          props.halfLength
+          props.halfLength,
+          props.overtimeLength
         )}
       />
 
@@ -153,7 +160,8 @@ const KillFeedItem = (
             color={playerColor(
               startTeams[kill.assister.toString()],
               round,
-              props.halfLength
+              props.halfLength,
+          props.overtimeLength
             )}
           />
         </>
@@ -171,7 +179,8 @@ const KillFeedItem = (
         color={playerColor(
           startTeams[props.victim.toString()],
           round,
-          props.halfLength
+          props.halfLength,
+          props.overtimeLength
         )}
       />
       <KillLocation>{props.kill.victimLocation}</KillLocation>
@@ -204,6 +213,7 @@ const EventsFeed = (props: {
   playerNames: PlayerNames;
   round: number;
   halfLength: number;
+  overtimeLength: number;
 }) => (
   <Flex flexDirection="column" alignItems="start" mt={2} overflowX="auto">
     {props.events.map((event, j) => {
@@ -221,6 +231,7 @@ const EventsFeed = (props: {
               playerNames={props.playerNames}
               round={props.round}
               halfLength={props.halfLength}
+              overtimeLength={props.overtimeLength}
             />
           )}
 
@@ -239,6 +250,21 @@ const EventsFeed = (props: {
           {event.kind === "bomb_explode" && (
             <EventBox borderColor="gray">Bomb exploded</EventBox>
           )}
+
+          {event.kind === "trade" && (
+            <EventBox borderColor="gray">
+              {props.playerNames[event.killer]} traded{" "}
+              {props.playerNames[event.traded]} (
+              {(event.timeToTrade / 1000).toFixed(1)}s)
+            </EventBox>
+          )}
+
+          {event.kind === "failed_trade" && (
+            <EventBox borderColor="gray">
+              {props.playerNames[event.player]} didn't trade{" "}
+              {props.playerNames[event.traded]}
+            </EventBox>
+          )}
         </Flex>
       );
     })}
@@ -251,6 +277,7 @@ export const RoundByRoundList = (props: {
   playerNames: PlayerNames;
   rounds: Round[];
   halfLength: number;
+  overtimeLength: number;
 }) => {
   return (
     <Accordion allowMultiple>
@@ -317,6 +344,7 @@ export const RoundByRoundList = (props: {
                       playerNames={props.playerNames}
                       round={i + 1}
                       halfLength={props.halfLength}
+                      overtimeLength={props.overtimeLength}
                     />
                   ) : (
                     <></>
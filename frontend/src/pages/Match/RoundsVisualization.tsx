@@ -115,11 +115,14 @@ export const RoundsVisualization = (props: { data: Match }) => {
   const teamAStartSide = data.roundByRound[0].teamASide;
   const teamBStartSide = data.roundByRound[0].teamBSide;
 
-  const halfLength = data.halfLength;
+  const { halfLength, overtimeLength } = data;
+  const otHalf = overtimeLength / 2;
   const overtimes =
     data.rounds.length > halfLength * 2
       ? Array.from(
-          Array(Math.ceil((data.rounds.length - halfLength * 2) / 6)).keys()
+          Array(
+            Math.ceil((data.rounds.length - halfLength * 2) / overtimeLength)
+          ).keys()
         )
       : [];
 
@@ -152,25 +155,25 @@ export const RoundsVisualization = (props: { data: Match }) => {
         </FlexCol>
 
         {overtimes.map((ot) => {
-          const i = halfLength * 2 + ot * 6;
+          const i = halfLength * 2 + ot * overtimeLength;
           const sideA = ot % 2 === 0 ? teamBStartSide : teamAStartSide;
           const sideB = ot % 2 === 0 ? teamAStartSide : teamBStartSide;
           return (
             <FlexCol ml={5} key={`otscore${ot}`}>
               <Flex>
-                <ScoreNumber side={sideA} rounds={[i, i + 3]} />
+                <ScoreNumber side={sideA} rounds={[i, i + otHalf]} />
                 <Heading fontSize="3xl" mx={0.5}>
                   :
                 </Heading>
-                <ScoreNumber side={sideB} rounds={[i + 3, i + 6]} />
+                <ScoreNumber side={sideB} rounds={[i + otHalf, i + overtimeLength]} />
               </Flex>
               <Text>OT {ot + 1}</Text>
               <Flex>
-                <ScoreNumber side={sideB} rounds={[i, i + 3]} />
+                <ScoreNumber side={sideB} rounds={[i, i + otHalf]} />
                 <Heading fontSize="3xl" mx={0.5}>
                   :
                 </Heading>
-                <ScoreNumber side={sideA} rounds={[i + 3, i + 6]} />
+                <ScoreNumber side={sideA} rounds={[i + otHalf, i + overtimeLength]} />
               </Flex>
             </FlexCol>
           );
@@ -190,21 +193,21 @@ export const RoundsVisualization = (props: { data: Match }) => {
       />
       {overtimes
         .map((ot) => {
-          const i = halfLength * 2 + ot * 6;
+          const i = halfLength * 2 + ot * overtimeLength;
           const sideA = ot % 2 === 0 ? teamBStartSide : teamAStartSide;
           const sideB = ot % 2 === 0 ? teamAStartSide : teamBStartSide;
           return [
             <Divider orientation="vertical" mx={5} key={`otdiv${ot}`} />,
             <RoundResultGrid
               rounds={data.rounds}
-              range={[i, i + 3]}
+              range={[i, i + otHalf]}
               styles={{ mr: 1 }}
               topTeam={sideA}
               key={`otviz1_${ot}`}
             />,
             <RoundResultGrid
               rounds={data.rounds}
-              range={[i + 3, i + 6]}
+              range={[i + otHalf, i + overtimeLength]}
               topTeam={sideB}
               key={`otviz2_${ot}`}
             />,
@@ -315,6 +315,7 @@ export const MatchPage = () => {
               playerNames={match.meta.playerNames}
               rounds={match.matchData.rounds}
               halfLength={match.matchData.halfLength}
+              overtimeLength={match.matchData.overtimeLength}
             />
           </TabPanel>
         </TabPanels>
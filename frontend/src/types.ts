@@ -47,6 +47,24 @@ export type Round = {
   planterTime: number;
   defuserTime: number;
   bombExplodeTime: number;
+  ctEconomy: TeamEconomy;
+  tEconomy: TeamEconomy;
+};
+
+export type BuyType = "pistol" | "eco" | "force" | "half" | "full" | "";
+
+export type TeamEconomy = {
+  numPlayers: number;
+  startMoney: number;
+  equipmentValue: number;
+  moneySpent: number;
+  buyType: BuyType;
+};
+
+export type PlayerEconomy = {
+  startMoney: number;
+  equipmentValue: number;
+  moneySpent: number;
 };
 
 export type HeadToHead = { [key: string]: { [key: string]: number } };
@@ -86,11 +104,32 @@ export type BombExplodeEvent = {
   time: number;
 };
 
+export type TradeEvent = {
+  kind: "trade";
+  // killer killed victim after victim killed traded
+  killer: string;
+  victim: string;
+  traded: string;
+  timeToTrade: number;
+  time: number;
+};
+
+export type FailedTradeEvent = {
+  kind: "failed_trade";
+  // player was near traded when killer killed them and nobody traded it
+  killer: string;
+  traded: string;
+  player: string;
+  time: number;
+};
+
 export type RoundEvent =
   | KillEvent
   | PlantEvent
   | DefuseEvent
-  | BombExplodeEvent;
+  | BombExplodeEvent
+  | TradeEvent
+  | FailedTradeEvent;
 
 export type RoundByRound = {
   teamAScore: number;
@@ -98,8 +137,20 @@ export type RoundByRound = {
   teamASide: Team;
   teamBSide: Team;
   events: RoundEvent[];
+  teamAEconomy: TeamEconomy;
+  teamBEconomy: TeamEconomy;
+  economy: { [key: string]: PlayerEconomy };
+  clutch?: Clutch;
 }[];
 
+export type Clutch = {
+  player: string;
+  side: Team;
+  opponents: number;
+  time: number;
+  won: boolean;
+};
+
 export type Kill = {
   weapon: string;
   assister: string;
@@ -116,6 +167,14 @@ export type Kill = {
 
 export type DemoType = "esea" | "pugsetup" | "faceit" | "steam";
 
+export type DateSource =
+  | "filename"
+  | "matchinfo"
+  | "modified"
+  | "parsed"
+  | "override"
+  | "";
+
 export type UserMeta = {
   demoLink?: string;
   dateOverride?: number;
@@ -125,7 +184,9 @@ export type MatchInfo = {
   id: string;
   map: string;
   dateTimestamp: number;
+  dateSource: DateSource;
   demoType: DemoType;
+  demoTypeConfidence: number;
   playerNames: { [key: string]: string };
   teamAScore: number;
   teamBScore: number;
@@ -133,12 +194,24 @@ export type MatchInfo = {
   teamBTitle: string;
 };
 
+export type Half = {
+  overtime: number;
+  startRound: number;
+  endRound: number;
+  teamASide: Team;
+  teamBSide: Team;
+  teamAScore: number;
+  teamBScore: number;
+};
+
 export type MatchData = {
   totalRounds: number;
   teams: TeamsMap;
   startTeams: TeamsMap;
   rounds: Round[];
   halfLength: number;
+  overtimeLength: number;
+  halves: Half[];
   openingKills: OpeningKill[];
 
   stats: Stats;
@@ -182,9 +255,234 @@ export type Stats = {
   teammatesFlashed: NumericMap;
   tradeKills: NumericMap;
   utilDamage: NumericMap;
+  failedTrades: NumericMap;
+  timeToTrade: NumericMap;
+
+  clutchAttempts: NumericMap;
+  clutchWins: NumericMap;
+  clutch1v1Attempts: NumericMap;
+  clutch1v1Wins: NumericMap;
+  clutch1v2Attempts: NumericMap;
+  clutch1v2Wins: NumericMap;
+  clutch1v3Attempts: NumericMap;
+  clutch1v3Wins: NumericMap;
+  clutch1v4Attempts: NumericMap;
+  clutch1v4Wins: NumericMap;
+  clutch1v5Attempts: NumericMap;
+  clutch1v5Wins: NumericMap;
 
   "2k": NumericMap;
   "3k": NumericMap;
   "4k": NumericMap;
   "5k": NumericMap;
+
+  shotsFired: NumericMap;
+  shotsHit: NumericMap;
+  accuracy: NumericMap;
+  firstShotsFired: NumericMap;
+  firstShotsHit: NumericMap;
+  firstShotAccuracy: NumericMap;
+  headHits: NumericMap;
+  chestHits: NumericMap;
+  stomachHits: NumericMap;
+  armHits: NumericMap;
+  legHits: NumericMap;
+
+  // Only present in matches parsed after weapon stats were added
+  weapons?: { [steamId: string]: { [weapon: string]: WeaponStats } };
+};
+
+export type WeaponStats = {
+  kills: number;
+  headshots: number;
+  damage: number;
+  shots: number;
+  hits: number;
+  firstShots: number;
+  firstShotHits: number;
+  headHits: number;
+  chestHits: number;
+  stomachHits: number;
+  armHits: number;
+  legHits: number;
+  accuracy: number;
+  firstShotAccuracy: number;
+  headshotPct: number;
+};
+
+export type MatchResult = "win" | "loss" | "tie";
+
+export type CareerStats = {
+  matches: number;
+  wins: number;
+  losses: number;
+  ties: number;
+  rounds: number;
+  kills: number;
+  deaths: number;
+  assists: number;
+  kdiff: number;
+  kd: number;
+  kpr: number;
+  adr: number;
+  hltv: number;
+  impact: number;
+  kast: number;
+  headshotPct: number;
+  rws: number;
+  openingKills: number;
+  openingDeaths: number;
+  tradeKills: number;
+  deathsTraded: number;
+  clutchAttempts: number;
+  clutchWins: number;
+  utilDamage: number;
+  flashAssists: number;
+  enemiesFlashed: number;
+
+  shotsFired: number;
+  shotsHit: number;
+  accuracy: number;
+  firstShotAccuracy: number;
+
+  "2k": number;
+  "3k": number;
+  "4k": number;
+  "5k": number;
+};
+
+export type PlayerSummary = {
+  steamId: string;
+  name: string;
+  lastPlayed: number;
+  stats: CareerStats;
+};
+
+export type PlayerMatchSummary = {
+  meta: MatchInfo;
+  result: MatchResult;
+  kills: number;
+  deaths: number;
+  assists: number;
+  adr: number;
+  hltv: number;
+  kast: number;
+};
+
+export type PlayerProfile = PlayerSummary & {
+  maps: { [key: string]: CareerStats };
+  weapons: { [key: string]: WeaponStats };
+  matches: PlayerMatchSummary[];
+};
+
+export type GrenadeKind = "flash" | "he" | "smoke" | "molotov" | "decoy";
+
+export type RadarPoint = {
+  x: number;
+  y: number;
+};
+
+export type Grenade = {
+  thrower: string;
+  side: Team;
+  kind: GrenadeKind;
+  throwTime: number;
+  detonateTime: number;
+  throw: RadarPoint;
+  land: RadarPoint;
+  trajectory: RadarPoint[];
+  // milliseconds each player was blinded for
+  blinded?: NumericMap;
+  // health damage done to each enemy
+  damage?: NumericMap;
+};
+
+export type ReplayPlayer = {
+  id: string;
+  s: Team;
+  x: number;
+  y: number;
+  r: number;
+  hp: number;
+  w: string;
+};
+
+export type ReplayFrame = {
+  t: number;
+  p: ReplayPlayer[];
+};
+
+export type JobStatus = "queued" | "running" | "done" | "failed";
+
+export type Job = {
+  id: string;
+  demoId: string;
+  status: JobStatus;
+  error?: string;
+  attempts: number;
+  username?: string;
+  createdAt: number;
+  updatedAt: number;
+};
+
+export type ServerEventType =
+  | "rescan_started"
+  | "rescan_finished"
+  | "demo_discovered"
+  | "demo_renamed"
+  | "demo_queued"
+  | "parse_started"
+  | "parse_progress"
+  | "parse_completed"
+  | "parse_failed"
+  | "ping";
+
+export type ServerEvent = {
+  type: ServerEventType;
+  timestamp: number;
+  demoId?: string;
+  newDemoId?: string;
+  jobId?: string;
+  trigger?: string;
+  progress?: number;
+  error?: string;
+};
+
+export type LeaderboardEntry = {
+  rank: number;
+  steamId: string;
+  name: string;
+  matches: number;
+  value: number;
+};
+
+export type Leaderboard = {
+  metric: keyof Stats;
+  aggregate: "average" | "total";
+  entries: LeaderboardEntry[];
+};
+
+export type RatingChange = {
+  matchId: string;
+  steamId: string;
+  date: number;
+  ratingBefore: number;
+  ratingAfter: number;
+};
+
+export type BalancePlayer = {
+  steamId: string;
+  name: string;
+  rating: number;
+  strength: number;
+  mapHltv: number;
+  mapMatches: number;
+};
+
+export type TeamSplit = {
+  teamA: BalancePlayer[];
+  teamB: BalancePlayer[];
+  teamARating: number;
+  teamBRating: number;
+  teamAWinProbability: number;
 };